@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// parentIndex yields the index, in Points(depth-1), of the segment which
+// produced the one at index in Points(depth), or -1 if there isn't one.
+// It follows the layout Render uses: each segment is replaced by one
+// segment per base point, in order, except that pruned segments are copied
+// as they are.
+func (f *Fractal) parentIndex(depth, index int) int {
+	if depth < 1 || index < 0 || index >= len(f.Points(depth)) {
+		return -1
+	}
+	// depth 1 comes from the root whatever its flags are
+	if depth == 1 {
+		return 0
+	}
+	offset := 0
+	for i, p := range f.Points(depth - 1) {
+		n := len(f.Base)
+		if p.Flags&Prune != 0 {
+			n = 1
+		}
+		offset += n
+		if index < offset {
+			return i
+		}
+	}
+	return -1
+}
+
+// ancestorIndices yields the index of each of the ancestors of the
+// segment at index in Points(depth): the one at depth d is indices[d], so
+// indices[0] is the root, and indices[depth] is index. It's nil if there's
+// no such segment.
+func (f *Fractal) ancestorIndices(depth, index int) []int {
+	if depth < 0 || index < 0 || index >= len(f.Points(depth)) {
+		return nil
+	}
+	indices := make([]int, depth+1)
+	indices[depth] = index
+	for d := depth; d > 0; d-- {
+		parent := f.parentIndex(d, indices[d])
+		if parent < 0 {
+			return nil
+		}
+		indices[d-1] = parent
+	}
+	return indices
+}
+
+// AncestorChain yields the segments which produced the one at index in
+// Points(depth), each given by the point ending it: chain[d] is the
+// ancestor at depth d, from the root at depth 0 down to the segment itself
+// at depth. It's nil if there's no such segment.
+func (f *Fractal) AncestorChain(depth, index int) []Point {
+	indices := f.ancestorIndices(depth, index)
+	if indices == nil {
+		return nil
+	}
+	chain := make([]Point, len(indices))
+	for d, i := range indices {
+		chain[d] = f.Points(d)[i]
+	}
+	return chain
+}
+
+// TraceAncestors picks the segment at index in Points(depth) to show the
+// ancestry of, or clears it if there's no such segment. It's cleared when
+// the fractal changes, too.
+func (f *Fractal) TraceAncestors(depth, index int) {
+	f.trace = f.ancestorIndices(depth, index)
+	if f.trace != nil {
+		fmt.Printf("segment %d at depth %d comes from segments %v\n", index, depth, f.trace)
+	}
+}
+
+// DrawAncestors highlights a segment and its ancestors, as found by
+// ancestorIndices, each in its depth's color. The root is widest, width
+// target pixels, and each depth is narrower than the one before, so the
+// deeper segments show on top of the ones they came from.
+func DrawAncestors(target pixel.Target, matrix pixel.Matrix, frac *Fractal, indices []int, width float64, shift int16) {
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	n := float64(len(indices))
+	for d, i := range indices {
+		points := frac.Points(d)
+		if i >= len(points) {
+			return
+		}
+		from := pixel.Vec{}
+		if i > 0 {
+			from = points[i-1].Vec
+		}
+		imd.Color = frac.colorTab[modPlus(frac.DepthColor(d, frac.Settings.LogDepthColor)+shift, 1024)]
+		imd.Push(from, points[i].Vec)
+		imd.Line(width * (n - float64(d)) / n / matrix[0])
+	}
+	imd.Draw(target)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/sqweek/dialog"
+)
+
+// autoSaver periodically writes the fractal to a recovery file, so that
+// closing the window or crashing doesn't lose everything since the last
+// save.
+type autoSaver struct {
+	path     string
+	interval int // in seconds; 0 or less disables autosaving
+	elapsed  int
+	last     []byte // what was last written, to skip redundant writes
+	// saving is set while a save is being written, so that a slow write
+	// can't have another one writing the same temporary file at once.
+	saving atomic.Bool
+}
+
+// Tick should be called once a second, and saves if it's been long enough.
+func (a *autoSaver) Tick(f *Fractal) {
+	if a.interval <= 0 {
+		return
+	}
+	a.elapsed++
+	if a.elapsed < a.interval {
+		return
+	}
+	if a.saving.Load() {
+		// the last save is still being written; try again next tick
+		return
+	}
+	a.elapsed = 0
+	jsonstr, err := json.Marshal(*f)
+	if err != nil {
+		fmt.Printf("autosave: json: %s\n", err)
+		return
+	}
+	if bytes.Equal(jsonstr, a.last) {
+		return
+	}
+	a.last = jsonstr
+	// the marshaling has to happen here, but the file I/O doesn't have
+	// to hold up a frame. Writing to a temporary file and renaming it means
+	// a crash mid-write doesn't clobber the previous autosave.
+	path := a.path
+	a.saving.Store(true)
+	go func() {
+		defer a.saving.Store(false)
+		tmp := path + ".tmp"
+		err := writeSaved(tmp, jsonstr)
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			fmt.Printf("autosave: %s\n", err)
+		}
+	}()
+}
+
+// offerRecovery checks for an autosave, and offers to restore it. Explicit
+// saves remove the recovery file, so if there is one, it has something
+// newer than the last explicit save.
+func offerRecovery(f *Fractal) {
+	info, err := os.Stat(*recoveryPath)
+	if err != nil {
+		return
+	}
+	restore := dialog.Message("There's an autosaved fractal from %s which was never saved. Restore it?",
+		info.ModTime().Format(time.Stamp)).Title("Restore Fractal").YesNo()
+	if !restore {
+		return
+	}
+	err = f.LoadFrom(*recoveryPath)
+	if err != nil {
+		fmt.Printf("restore: %s\n", err)
+	}
+}
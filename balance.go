@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// Centroid yields the center of mass of the curve at the given depth,
+// which is clamped to the depths rendered so far, treating the lines as
+// wire of even weight: each segment counts at its midpoint, weighted by
+// its length, so a dense tangle of short segments doesn't outweigh a few
+// long ones. Hidden segments aren't counted. If nothing has any length,
+// it's just the average of the points.
+func (f *Fractal) Centroid(depth int) pixel.Vec {
+	if depth > f.Depth {
+		depth = f.Depth
+	}
+	if depth < 0 {
+		depth = 0
+	}
+	points := f.Points(depth)
+	if len(points) == 0 {
+		return pixel.Vec{}
+	}
+	var sum, plain pixel.Vec
+	total := 0.0
+	prev := pixel.Vec{}
+	for _, p := range points {
+		plain = plain.Add(p.Vec)
+		if p.Flags&Hide == 0 {
+			length := p.Vec.Sub(prev).Len()
+			sum = sum.Add(pixel.Lerp(prev, p.Vec, 0.5).Scaled(length))
+			total += length
+		}
+		prev = p.Vec
+	}
+	if total == 0 {
+		return plain.Scaled(1 / float64(len(points)))
+	}
+	return sum.Scaled(1 / total)
+}
+
+// Balance yields how far the centroid of the given depth is from the
+// center of its bounds, as a fraction of the bounds' diagonal; 0 is
+// perfectly centered.
+func (f *Fractal) Balance(depth int) float64 {
+	if depth > f.Depth {
+		depth = f.Depth
+	}
+	bounds := f.BoundsAt(depth)
+	size := bounds.Size().Len()
+	if size == 0 {
+		return 0
+	}
+	return f.Centroid(depth).Sub(bounds.Center()).Len() / size
+}
+
+// DrawCentroid marks the centroid of the given depth with a cross, and the
+// center of its bounds with a ring, size target pixels across, so the
+// distance between them shows how off-center the fractal is.
+func DrawCentroid(target pixel.Target, matrix pixel.Matrix, frac *Fractal, depth int, size float64) {
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	if depth > frac.Depth {
+		depth = frac.Depth
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	size /= matrix[0]
+	c := frac.Centroid(depth)
+	imd.Color = pixel.RGBA{R: 1, G: 1, B: 1, A: 1}
+	imd.Push(c.Add(pixel.Vec{X: -size / 2}), c.Add(pixel.Vec{X: size / 2}))
+	imd.Line(size / 8)
+	imd.Push(c.Add(pixel.Vec{Y: -size / 2}), c.Add(pixel.Vec{Y: size / 2}))
+	imd.Line(size / 8)
+	imd.Color = pixel.RGBA{R: .6, G: .6, B: .6, A: 1}
+	imd.Push(frac.BoundsAt(depth).Center())
+	imd.Circle(size/2, size/8)
+	imd.Draw(target)
+}
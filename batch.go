@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// batchMaxOOM is the point budget used when rendering fractals headlessly,
+// unless they say what they need.
+const batchMaxOOM = 20
+
+// batchMaxLine is the longest line renderBatch accepts; the default for
+// bufio.Scanner is too short for a fractal with a lot of base points.
+const batchMaxLine = 16 << 20
+
+// renderBatch reads fractals, one JSON object per line, from the named file,
+// or standard input for "-", and renders the deepest depth of each to
+// frame-NNNN.png in outDir, numbered by line, at its logical size, or the
+// print size if -width is set. Lines
+// which can't be read or rendered are reported and skipped, and blank lines
+// are ignored. It returns an exit status: 0 if everything rendered, 1 if
+// anything didn't, 2 if the input couldn't be read at all.
+func renderBatch(name, outDir string) int {
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+		defer file.Close()
+		in = file
+	}
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, batchMaxLine)
+	lineNo, lines, rendered := 0, 0, 0
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		lines++
+		label := fmt.Sprintf("%s:%d", name, lineNo)
+		path := filepath.Join(outDir, fmt.Sprintf("frame-%04d.png", lineNo))
+		err = renderBatchLine(scanner.Bytes(), label, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", label, err)
+			continue
+		}
+		rendered++
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+	}
+	fmt.Fprintf(os.Stderr, "rendered %d of %d fractals to %s\n", rendered, lines, outDir)
+	switch {
+	case scanner.Err() != nil && lines == 0:
+		return 2
+	case rendered != lines || scanner.Err() != nil:
+		return 1
+	}
+	return 0
+}
+
+// renderBatchLine renders one line's fractal to path.
+func renderBatchLine(line []byte, label, path string) error {
+	saved, err := parseFractal(line, label)
+	if err != nil {
+		return err
+	}
+	// a fractal that says how big a budget it needs gets it
+	oom := saved.MaxOOM
+	if oom == 0 {
+		oom = batchMaxOOM
+	}
+	f, err := newQuietFractal(saved.Base, oom)
+	if err != nil {
+		return err
+	}
+	f.useSaved(saved)
+	f.Changed()
+	return f.ExportPNGSized(path, f.MaxDepth-1)
+}
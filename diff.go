@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// diffMaxOOM is the point budget used when rendering fractals for comparison.
+const diffMaxOOM = 18
+
+// diffFiles loads two saved fractals and prints a summary of the differences
+// between them. It returns an exit status in the style of diff(1): 0 if they
+// are the same, 1 if they differ, 2 if something went wrong.
+func diffFiles(nameA, nameB string) int {
+	a, err := ReadFractal(nameA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", nameA, err)
+		return 2
+	}
+	b, err := ReadFractal(nameB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", nameB, err)
+		return 2
+	}
+	differ := false
+	if len(a.Base) != len(b.Base) {
+		fmt.Printf("base length: %d -> %d\n", len(a.Base), len(b.Base))
+		differ = true
+	}
+	if diffBases(a.Base, b.Base) {
+		differ = true
+	}
+	if a.InverseMode != b.InverseMode {
+		fmt.Printf("inverse mode: %s -> %s\n", inverseModeNames[a.InverseMode], inverseModeNames[b.InverseMode])
+		differ = true
+	}
+	if a.FlagMode != b.FlagMode {
+		fmt.Printf("flag mode: %s -> %s\n", flagModeNames[a.FlagMode], flagModeNames[b.FlagMode])
+		differ = true
+	}
+	if a.ColorMode != b.ColorMode {
+		fmt.Printf("color mode: %s -> %s\n", colorModeNames[a.ColorMode], colorModeNames[b.ColorMode])
+		differ = true
+	}
+	if a.WrapMode != b.WrapMode {
+		fmt.Printf("wrap mode: %s -> %s\n", wrapModeNames[a.WrapMode], wrapModeNames[b.WrapMode])
+		differ = true
+	}
+	if a.GlobalFixedColor != b.GlobalFixedColor {
+		fmt.Printf("global fixed color: %s -> %s\n", globalFixedNames[a.GlobalFixedColor], globalFixedNames[b.GlobalFixedColor])
+		differ = true
+	}
+	if a.Root != b.Root {
+		fmt.Printf("root: %v -> %v\n", a.Root.Vec, b.Root.Vec)
+		differ = true
+	}
+	fa, err := newQuietFractal(a.Base, diffMaxOOM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", nameA, err)
+		return 2
+	}
+	fa.useSaved(a)
+	fa.Changed()
+	fb, err := newQuietFractal(b.Base, diffMaxOOM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", nameB, err)
+		return 2
+	}
+	fb.useSaved(b)
+	fb.Changed()
+	for i := 0; i < fa.MaxDepth; i++ {
+		fa.Render(i)
+	}
+	for i := 0; i < fb.MaxDepth; i++ {
+		fb.Render(i)
+	}
+	if fa.Bounds != fb.Bounds {
+		fmt.Printf("bounds: %v -> %v\n", fa.Bounds, fb.Bounds)
+		differ = true
+	}
+	if !differ {
+		fmt.Printf("%s and %s are the same\n", nameA, nameB)
+		return 0
+	}
+	return 1
+}
+
+// diffBases reports per-point differences between two bases, and returns
+// true if there were any. Bases of the same length are compared point by
+// point. Otherwise, the points are aligned on a longest common subsequence
+// of identical points, and anything left over is reported as an insertion
+// or deletion, which is what you usually get from AddPoint or DelPoint.
+func diffBases(a, b []Point) bool {
+	differ := false
+	if len(a) == len(b) {
+		for i := range a {
+			if diffPoint(i, a[i], b[i]) {
+				differ = true
+			}
+		}
+		return differ
+	}
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Printf("point %d: inserted [%s]\n", j+1, b[j])
+			differ = true
+			j++
+		default:
+			fmt.Printf("point %d: deleted [%s]\n", i+1, a[i])
+			differ = true
+			i++
+		}
+	}
+	return differ
+}
+
+// diffPoint reports the differences between two points with the same index.
+func diffPoint(index int, p0, p1 Point) bool {
+	if p0 == p1 {
+		return false
+	}
+	fmt.Printf("point %d:", index+1)
+	if p0.X != p1.X {
+		fmt.Printf(" X %+.3f", p1.X-p0.X)
+	}
+	if p0.Y != p1.Y {
+		fmt.Printf(" Y %+.3f", p1.Y-p0.Y)
+	}
+	if p0.Color != p1.Color {
+		fmt.Printf(" Color %+d", p1.Color-p0.Color)
+	}
+	if p0.Color2 != p1.Color2 {
+		fmt.Printf(" Color2 %+d", p1.Color2-p0.Color2)
+	}
+	if p0.Flags != p1.Flags {
+		fmt.Printf(" Flags 0x%03x -> 0x%03x", p0.Flags, p1.Flags)
+	}
+	fmt.Printf("\n")
+	return true
+}
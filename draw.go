@@ -0,0 +1,668 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// DrawOptions controls how Draw renders a fractal.
+type DrawOptions struct {
+	// LineWidth is in target pixels, not fractal units.
+	LineWidth float64
+	// PaletteShift is added to every color index when drawing.
+	PaletteShift int16
+	// DepthCap limits the depths drawn (0 for no limit), and OnlyDeepest
+	// draws only the deepest one that's shown.
+	DepthCap    int
+	OnlyDeepest bool
+	// LogDepth maps depths onto the palette logarithmically in
+	// ColorByDepth mode.
+	LogDepth bool
+	// Flush, if non-nil, is called after each depth is drawn, so the caller
+	// can composite each depth separately.
+	Flush func()
+	// SinglePass draws all the depths at once, and flushes just once,
+	// which is much faster, but lines of different depths then blend the
+	// way lines within a depth do, rather than adding up.
+	SinglePass bool
+	// Exposure scales every color, to tame or boost the glow where lines
+	// overlap; 0 is treated as 1. Fade, if non-zero, scales them further,
+	// for drawing faint ghosts.
+	Exposure float64
+	Fade     float64
+	// Solid, if it isn't transparent, is used instead of the palette.
+	Solid pixel.RGBA
+	// OriginSegment starts each depth's line at the origin. Every depth
+	// is a path from [0,0] to [1,0], and the points only store the ends
+	// of segments, so the origin is the implicit start of the first one;
+	// without it the first segment isn't drawn. That's what you want when
+	// the first point is somewhere off the curve, such as a hidden jump,
+	// and the line from the origin is a spurious artifact.
+	OriginSegment bool
+	// ClosedCurve treats each depth as wrapping around, so the origin
+	// takes the last point's color, and the segment from it blends from
+	// the end of the curve into the start. Otherwise the curve is open,
+	// and that segment is just the first point's color.
+	ClosedCurve bool
+	// Posterize, if non-zero, flattens the palette into that many evenly
+	// spaced colors.
+	Posterize int
+	// Retain lets Draw reuse the lines it built last time, if nothing
+	// has changed since.
+	Retain bool
+	// Vignette darkens lines towards the edges of Frame, which is in
+	// target coordinates; see vignette.
+	Vignette float64
+	Frame    pixel.Rect
+	// HiddenDepths has a bit set for each depth not to draw.
+	HiddenDepths uint64
+	// CapPolicy is what happens to the ends of lines where a hidden
+	// segment cuts them off.
+	CapPolicy int
+	// Explode moves each branch of ExplodeDepth, and what it produces,
+	// outwards by that much of the size of the fractal; see
+	// explodedPoints. 0 draws the fractal as it is.
+	Explode      float64
+	ExplodeDepth int
+}
+
+// Cap policies, for the ends of lines next to hidden segments. CapSharp
+// leaves them alone. CapFade fades each segment next to a cut out to
+// nothing at the cut, which softens the edge; segments away from cuts
+// aren't affected. Pruned segments are still drawn, so they don't make
+// cuts.
+const (
+	CapSharp = iota
+	CapFade
+	capPolicies
+)
+
+var capPolicyNames = [capPolicies]string{"Sharp", "Fade"}
+
+// vignette yields the brightness of a vignette of the given strength at v
+// in frame: 1 at the center, falling off with the square of the distance
+// from it, to 1-strength at the corners.
+func vignette(strength float64, v pixel.Vec, frame pixel.Rect) float64 {
+	if strength == 0 || frame.Area() == 0 {
+		return 1
+	}
+	d := v.Sub(frame.Center()).Len() / (frame.Size().Len() / 2)
+	return math.Max(0, 1-strength*d*d)
+}
+
+// vignetted applies the vignette to a color drawn at v, which is in
+// target coordinates.
+func (opts DrawOptions) vignetted(c pixel.RGBA, v pixel.Vec) pixel.RGBA {
+	if opts.Vignette == 0 {
+		return c
+	}
+	return c.Scaled(vignette(opts.Vignette, v, opts.Frame))
+}
+
+// shade applies the solid color, exposure, and fade, if any, to a color.
+func (opts DrawOptions) shade(c pixel.RGBA) pixel.RGBA {
+	if opts.Solid.A != 0 {
+		c = opts.Solid
+	}
+	if opts.Exposure != 0 {
+		c = c.Scaled(opts.Exposure)
+	}
+	if opts.Fade != 0 {
+		c = c.Scaled(opts.Fade)
+	}
+	return c
+}
+
+// gammaCorrect raises each channel of a color, clamped to 0 to 1, to the
+// power 1/gamma, leaving alpha alone. It's applied to the finished image,
+// after the lines are added up, not to each line; see gammaPicture for the
+// display. A gamma of 0 or 1 does nothing.
+func gammaCorrect(c pixel.RGBA, gamma float64) pixel.RGBA {
+	if gamma == 0 || gamma == 1 {
+		return c
+	}
+	g := func(x float64) float64 {
+		return math.Pow(math.Max(0, math.Min(1, x)), 1/gamma)
+	}
+	return pixel.RGBA{R: g(c.R), G: g(c.G), B: g(c.B), A: c.A}
+}
+
+// gammaPixels applies gammaCorrect to RGBA pixels, four bytes each, in
+// place. There are only 256 values a channel can have, so they're looked
+// up in a table rather than each raised to the power separately.
+func gammaPixels(pix []uint8, gamma float64) {
+	if gamma == 0 || gamma == 1 {
+		return
+	}
+	var table [256]uint8
+	for i := range table {
+		table[i] = uint8(math.Round(255 * math.Pow(float64(i)/255, 1/gamma)))
+	}
+	for i := 0; i+3 < len(pix); i += 4 {
+		pix[i], pix[i+1], pix[i+2] = table[pix[i]], table[pix[i+1]], table[pix[i+2]]
+	}
+}
+
+// gammaPicture yields the contents of a canvas, with gammaPixels applied,
+// as a picture to draw in its place. The display adds the lines up in a
+// canvas of their own when there's a gamma, so that it can be applied to
+// the finished composite, as it is in exports. Both count rows from the
+// bottom, so the pixels go across as they are.
+func gammaPicture(c *pixelgl.Canvas, gamma float64) *pixel.PictureData {
+	pix := c.Pixels()
+	gammaPixels(pix, gamma)
+	pic := pixel.MakePictureData(c.Bounds())
+	for i := range pic.Pix {
+		if 4*i+3 >= len(pix) {
+			break
+		}
+		pic.Pix[i] = color.RGBA{R: pix[4*i], G: pix[4*i+1], B: pix[4*i+2], A: pix[4*i+3]}
+	}
+	return pic
+}
+
+// color looks up a color index in the fractal's palette, applying the
+// palette shift, posterizing, and shading.
+func (opts DrawOptions) color(frac *Fractal, c int16) pixel.RGBA {
+	return opts.shade(frac.colorTab[posterize(modPlus(c+opts.PaletteShift, 1024), opts.Posterize)])
+}
+
+// maxPosterize is the most buckets posterizing allows; past that, it's
+// hard to tell from the smooth palette.
+const maxPosterize = 256
+
+// posterizeStep doubles or halves the number of posterize buckets, going
+// from off to 2 and back, and off again past maxPosterize.
+func posterizeStep(n int, up bool) int {
+	switch {
+	case up && n == 0:
+		return 2
+	case up && n*2 > maxPosterize:
+		return 0
+	case up:
+		return n * 2
+	case n <= 2:
+		return 0
+	default:
+		return n / 2
+	}
+}
+
+// posterize snaps a color index to the nearest of n evenly spaced buckets
+// around the palette, or leaves it alone if n is 0.
+func posterize(c int16, n int) int16 {
+	if n <= 0 {
+		return c
+	}
+	bucket := (int(c)*n + 512) / 1024 % n
+	return int16(bucket * 1024 / n)
+}
+
+// drawIMD is reused across calls to DrawVertices and DrawStream, so its
+// buffers don't have to be reallocated every frame.
+var drawIMD *imdraw.IMDraw
+
+// paletteGeneration is bumped whenever a color table is filled in, since
+// color tables are shared between fractals.
+var paletteGeneration uint64
+
+// drawCache is the geometry Draw last built for a fractal, one IMDraw per
+// depth, or just one in SinglePass mode, along with what it was built from.
+type drawCache struct {
+	valid      bool
+	generation uint64
+	palette    uint64
+	matrix     pixel.Matrix
+	opts       DrawOptions
+	imds       []*imdraw.IMDraw
+}
+
+// matches reports whether the cache was built from the same fractal state,
+// palette, matrix, and options.
+func (c *drawCache) matches(frac *Fractal, matrix pixel.Matrix, opts DrawOptions) bool {
+	return c.valid && c.generation == frac.generation && c.palette == paletteGeneration &&
+		c.matrix == matrix && c.opts.sameLines(opts)
+}
+
+// sameLines reports whether opts and o draw the same lines. This happens
+// every frame, so the fields are compared directly. Flush and Retain don't
+// change what's drawn, and funcs can't be compared anyway, so they're left
+// out; anything else added to DrawOptions needs to be added here.
+func (opts DrawOptions) sameLines(o DrawOptions) bool {
+	return opts.LineWidth == o.LineWidth && opts.PaletteShift == o.PaletteShift &&
+		opts.DepthCap == o.DepthCap && opts.OnlyDeepest == o.OnlyDeepest &&
+		opts.LogDepth == o.LogDepth && opts.SinglePass == o.SinglePass &&
+		opts.Exposure == o.Exposure && opts.Fade == o.Fade &&
+		opts.Solid == o.Solid && opts.OriginSegment == o.OriginSegment &&
+		opts.ClosedCurve == o.ClosedCurve && opts.Posterize == o.Posterize &&
+		opts.Vignette == o.Vignette && opts.Frame == o.Frame &&
+		opts.HiddenDepths == o.HiddenDepths && opts.CapPolicy == o.CapPolicy &&
+		opts.Explode == o.Explode && opts.ExplodeDepth == o.ExplodeDepth
+}
+
+// Draw renders the fractal's rendered depths into target, using matrix to
+// map fractal coordinates onto the target. With opts.Retain, the lines are
+// kept, and drawn again as they are on later calls, until the fractal,
+// palette, matrix, or options change.
+func Draw(target pixel.Target, matrix pixel.Matrix, frac *Fractal, opts DrawOptions) {
+	cache := &frac.drawCache
+	if !opts.Retain || !cache.matches(frac, matrix, opts) {
+		cache.build(matrix, frac, opts)
+	}
+	for _, imd := range cache.imds {
+		imd.Draw(target)
+		if opts.Flush != nil {
+			opts.Flush()
+		}
+	}
+}
+
+// build pushes the lines for each depth Draw should show into the cache's
+// IMDraws, reusing the ones it already has.
+func (c *drawCache) build(matrix pixel.Matrix, frac *Fractal, opts DrawOptions) {
+	width := opts.LineWidth / matrix[0]
+	shownDepth := frac.Depth
+	if opts.DepthCap != 0 && opts.DepthCap < shownDepth {
+		shownDepth = opts.DepthCap
+	}
+	firstDepth := 1
+	if opts.OnlyDeepest {
+		firstDepth = shownDepth
+	}
+	count := shownDepth - firstDepth + 1
+	if count < 0 {
+		count = 0
+	}
+	if opts.SinglePass && count > 1 {
+		count = 1
+	}
+	for len(c.imds) < count {
+		c.imds = append(c.imds, imdraw.New(nil))
+	}
+	c.imds = c.imds[:count]
+	for _, imd := range c.imds {
+		imd.Clear()
+		imd.SetMatrix(matrix)
+	}
+	for i := firstDepth; i <= shownDepth; i++ {
+		imd := c.imds[0]
+		if !opts.SinglePass {
+			imd = c.imds[i-firstDepth]
+		}
+		if opts.HiddenDepths&(1<<uint(i)) != 0 {
+			continue
+		}
+		points := frac.Points(i)
+		if opts.Explode != 0 {
+			points = frac.explodedPoints(i, opts.ExplodeDepth, opts.Explode, opts.OriginSegment)
+		}
+		byDepth := frac.ColorMode == ColorByDepth
+		depthColor := opts.color(frac, frac.DepthColor(i, opts.LogDepth))
+		colorOf := func(p *Point) pixel.RGBA {
+			c := depthColor
+			if !byDepth {
+				c = opts.color(frac, p.Color)
+			}
+			return opts.vignetted(c, matrix.Project(p.Vec))
+		}
+		fade := opts.CapPolicy == CapFade
+		// cut reports whether a line ends at point j because the next
+		// segment is hidden.
+		cut := func(j int) bool {
+			return fade && j+1 < len(points) && points[j+1].Flags&Hide != 0
+		}
+		// afterCut is set when prev is the end of a hidden segment.
+		afterCut := false
+		var prev *Point
+		if opts.OriginSegment {
+			origin := points[0].Color
+			if opts.ClosedCurve {
+				origin = points[len(points)-1].EndColor()
+			}
+			prev = &Point{Vec: pixel.Vec{}, Color: origin}
+		}
+		drawing := false
+		// dashAt carries the dash pattern along a run of dashed segments
+		dashAt := 0.0
+		for j := 0; j < len(points); j++ {
+			p := &points[j]
+			if p.Flags&(Hide|Dashed) != Dashed {
+				dashAt = 0
+			}
+			if p.Flags&Hide != 0 {
+				if drawing {
+					imd.Line(width)
+					drawing = false
+				}
+				prev = &Point{Vec: p.Vec, Color: p.EndColor()}
+				afterCut = fade
+				continue
+			}
+			if p.Flags&Dashed != 0 {
+				// a dashed segment is a line for each dash, so it ends
+				// whatever line was being drawn
+				var from *Point
+				switch {
+				case prev != nil:
+					from = prev
+				case drawing:
+					from = &points[j-1]
+					imd.Line(width)
+					drawing = false
+				}
+				if from != nil {
+					c0, c1 := colorOf(from), colorOf(p)
+					if p.Flags&HasColor2 != 0 {
+						c0 = colorOf(&Point{Vec: from.Vec, Color: p.Color})
+						c1 = colorOf(&Point{Vec: p.Vec, Color: p.Color2})
+					}
+					if afterCut {
+						c0 = pixel.RGBA{}
+					}
+					if cut(j) {
+						c1 = pixel.RGBA{}
+					}
+					a, b := from.Vec, p.Vec
+					dashSpans(b.Sub(a).Len(), dashPixels/matrix[0], &dashAt, func(t0, t1 float64) {
+						imd.Color = c0.Scaled(1 - t0).Add(c1.Scaled(t0))
+						imd.Push(pixel.Lerp(a, b, t0))
+						imd.Color = c0.Scaled(1 - t1).Add(c1.Scaled(t1))
+						imd.Push(pixel.Lerp(a, b, t1))
+						imd.Line(width)
+					})
+				}
+				prev = &Point{Vec: p.Vec, Color: p.EndColor()}
+				afterCut = false
+				continue
+			}
+			if p.Flags&HasColor2 != 0 {
+				// a gradient segment doesn't share colors with its
+				// neighbors, so it's a line of its own
+				from, ok := pixel.Vec{}, true
+				switch {
+				case prev != nil:
+					from = prev.Vec
+				case drawing:
+					from = points[j-1].Vec
+					imd.Line(width)
+					drawing = false
+				default:
+					ok = false
+				}
+				if ok {
+					imd.Color = colorOf(&Point{Vec: from, Color: p.Color})
+					if afterCut {
+						imd.Color = pixel.RGBA{}
+					}
+					imd.Push(from)
+					imd.Color = colorOf(&Point{Vec: p.Vec, Color: p.Color2})
+					if cut(j) {
+						imd.Color = pixel.RGBA{}
+					}
+					imd.Push(p.Vec)
+					imd.Line(width)
+				}
+				prev = &Point{Vec: p.Vec, Color: p.Color2}
+				afterCut = false
+				continue
+			}
+			if prev != nil {
+				imd.Color = colorOf(prev)
+				if afterCut {
+					imd.Color = pixel.RGBA{}
+				}
+				imd.Push(prev.Vec)
+				prev = nil
+			}
+			afterCut = false
+			imd.Color = colorOf(p)
+			if cut(j) {
+				imd.Color = pixel.RGBA{}
+			}
+			imd.Push(p.Vec)
+			drawing = true
+		}
+		if drawing {
+			imd.Line(width)
+		}
+	}
+	c.valid = true
+	c.generation = frac.generation
+	c.palette = paletteGeneration
+	c.matrix = matrix
+	c.opts = opts
+	c.opts.Flush = nil
+}
+
+// dashPixels is how long the dashes of Dashed segments, and the gaps
+// between them, are in target pixels.
+const dashPixels = 8.0
+
+// maxDashes is the most dashes one segment is split into; a segment that
+// would have more, because it's zoomed in a long way, gets longer dashes.
+const maxDashes = 1024
+
+// dashSpans calls fn with each dash along a segment length long, as the
+// fractions of the way along it the dash starts and ends, for dashes and
+// gaps period long. at is how far into the pattern the segment starts, and
+// is advanced past it, so the pattern carries on into the next segment.
+func dashSpans(length, period float64, at *float64, fn func(t0, t1 float64)) {
+	if length <= 0 {
+		return
+	}
+	if length > period*2*maxDashes {
+		period = length / (2 * maxDashes)
+	}
+	start := math.Floor(*at/(2*period))*2*period - *at
+	for s := start; s < length; s += 2 * period {
+		lo, hi := math.Max(s, 0), math.Min(s+period, length)
+		if hi > lo {
+			fn(lo/length, hi/length)
+		}
+	}
+	*at += length
+}
+
+// maxVertexMarkers is the most points DrawVertices will mark; past that,
+// they'd just be clutter.
+const maxVertexMarkers = 512
+
+// DrawVertices marks each point at the given depth with a dot, radius
+// target pixels across, so the discrete structure of the curve is visible.
+// It returns false, without drawing anything, if there are too many points.
+func DrawVertices(target pixel.Target, matrix pixel.Matrix, frac *Fractal, depth int, radius float64, shift int16) bool {
+	points := frac.Points(depth)
+	if len(points) > maxVertexMarkers {
+		return false
+	}
+	if len(points) == 0 {
+		return true
+	}
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	radius /= matrix[0]
+	imd.Color = frac.colorTab[modPlus(points[len(points)-1].Color+shift, 1024)]
+	imd.Push(pixel.Vec{})
+	imd.Circle(radius, 0)
+	for _, p := range points {
+		imd.Color = frac.colorTab[modPlus(p.Color+shift, 1024)]
+		imd.Push(p.Vec)
+		imd.Circle(radius, 0)
+	}
+	imd.Draw(target)
+	return true
+}
+
+// maxArrows is the most segments DrawArrows will mark.
+const maxArrows = 256
+
+// DrawArrows draws an arrowhead, size target pixels long, at the middle of
+// each segment at the given depth, pointing the way the curve runs, from
+// the origin through each point in order, which is also the order colors
+// accumulate in. Like DrawVertices, it returns false, without drawing
+// anything, if there are too many segments.
+func DrawArrows(target pixel.Target, matrix pixel.Matrix, frac *Fractal, depth int, size float64, shift int16) bool {
+	points := frac.Points(depth)
+	if len(points) > maxArrows {
+		return false
+	}
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	size /= matrix[0]
+	prev := pixel.Vec{}
+	for _, p := range points {
+		dir := p.Vec.Sub(prev)
+		if dir.Len() == 0 {
+			continue
+		}
+		mid := prev.Add(dir.Scaled(0.5))
+		back := dir.Unit().Scaled(-size)
+		imd.Color = frac.colorTab[modPlus(p.Color+shift, 1024)]
+		for _, angle := range []float64{math.Pi / 6, -math.Pi / 6} {
+			imd.Push(mid, mid.Add(back.Rotated(angle)))
+			imd.Line(size / 4)
+		}
+		prev = p.Vec
+	}
+	imd.Draw(target)
+	return true
+}
+
+// streamBatch is how many points DrawStream pushes before drawing them, so
+// its memory use doesn't depend on the depth.
+const streamBatch = 4096
+
+// DrawStream draws the curve at the given depth, computing it with
+// RenderStream rather than using the rendered depths, so it can draw depths
+// which would never fit in memory. It only draws the one depth, and since
+// the last point isn't known in advance, it always draws an open curve,
+// with the segment from the origin in the first point's color.
+func DrawStream(target pixel.Target, matrix pixel.Matrix, frac *Fractal, depth int, opts DrawOptions) {
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	width := opts.LineWidth / matrix[0]
+	color := func(p Point) pixel.RGBA {
+		if frac.ColorMode == ColorByDepth {
+			return opts.vignetted(opts.color(frac, frac.DepthColor(depth, opts.LogDepth)), matrix.Project(p.Vec))
+		}
+		return opts.vignetted(opts.color(frac, p.Color), matrix.Project(p.Vec))
+	}
+	start := Point{}
+	needStart := opts.OriginSegment
+	first := true
+	drawing := false
+	pushed := 0
+	var last pixel.Vec
+	frac.RenderStream(depth, func(p Point) {
+		if first {
+			start.Color = p.Color
+			first = false
+		}
+		if p.Flags&Hide != 0 {
+			if drawing {
+				imd.Line(width)
+				drawing = false
+			}
+			start, needStart = Point{Vec: p.Vec, Color: p.EndColor()}, true
+			return
+		}
+		if p.Flags&HasColor2 != 0 {
+			// a line of its own, as in Draw
+			from, ok := start.Vec, needStart
+			if drawing {
+				from, ok = last, true
+				imd.Line(width)
+				drawing = false
+			}
+			if ok {
+				imd.Color = color(Point{Vec: from, Color: p.Color})
+				imd.Push(from)
+				imd.Color = color(Point{Vec: p.Vec, Color: p.Color2})
+				imd.Push(p.Vec)
+				imd.Line(width)
+				pushed += 2
+			}
+			if pushed >= streamBatch {
+				imd.Draw(target)
+				imd.Clear()
+				pushed = 0
+			}
+			start, needStart = Point{Vec: p.Vec, Color: p.Color2}, true
+			return
+		}
+		if needStart {
+			imd.Color = color(start)
+			imd.Push(start.Vec)
+			needStart = false
+		}
+		imd.Color = color(p)
+		imd.Push(p.Vec)
+		last = p.Vec
+		drawing = true
+		pushed++
+		if pushed >= streamBatch {
+			// draw what we have, and pick the line up again from here
+			imd.Line(width)
+			imd.Draw(target)
+			imd.Clear()
+			pushed = 0
+			drawing = false
+			start, needStart = p, true
+		}
+	})
+	if drawing {
+		imd.Line(width)
+	}
+	imd.Draw(target)
+}
+
+// streamCache is the canvas DrawStream last drew a stream depth into, along
+// with what it was drawn from. Computing a stream depth takes a long time,
+// and keeping its lines, the way drawCache does, would take as much memory
+// as rendering it, which is what streaming avoids; the canvas is the same
+// size however deep the depth is.
+type streamCache struct {
+	generation uint64
+	palette    uint64
+	matrix     pixel.Matrix
+	depth      int
+	opts       DrawOptions
+	background pixel.RGBA
+	canvas     *pixelgl.Canvas
+}
+
+// Canvas yields a canvas covering bounds, with the given depth drawn on it
+// by DrawStream over background. It's only drawn again when the fractal,
+// palette, matrix, depth, options, bounds, or background change.
+func (c *streamCache) Canvas(bounds pixel.Rect, matrix pixel.Matrix, frac *Fractal, depth int, opts DrawOptions, background pixel.RGBA) *pixelgl.Canvas {
+	if c.canvas != nil && c.canvas.Bounds() == bounds && c.generation == frac.generation &&
+		c.palette == paletteGeneration && c.matrix == matrix && c.depth == depth &&
+		c.background == background && c.opts.sameLines(opts) {
+		return c.canvas
+	}
+	if c.canvas == nil {
+		c.canvas = pixelgl.NewCanvas(bounds)
+	}
+	c.canvas.SetBounds(bounds)
+	c.canvas.Clear(background)
+	DrawStream(c.canvas, matrix, frac, depth, opts)
+	c.generation, c.palette, c.matrix, c.depth = frac.generation, paletteGeneration, matrix, depth
+	c.opts, c.background = opts, background
+	return c.canvas
+}
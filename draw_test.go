@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// TestDrawDepths draws into a batch, which needs no window, and checks
+// that a line set is built, and flushed, for each depth that's shown.
+func TestDrawDepths(t *testing.T) {
+	f := testFractal(t, tentBase())
+	target := pixel.NewBatch(&pixel.TrianglesData{}, nil)
+	matrix := pixel.IM.Scaled(pixel.Vec{}, 100)
+	cases := []struct {
+		name string
+		opts DrawOptions
+		want int
+	}{
+		{"all", DrawOptions{}, f.Depth},
+		{"capped", DrawOptions{DepthCap: 3}, 3},
+		{"deepest", DrawOptions{OnlyDeepest: true}, 1},
+		{"single pass", DrawOptions{SinglePass: true}, 1},
+	}
+	for _, c := range cases {
+		flushes := 0
+		c.opts.LineWidth = 1
+		c.opts.Flush = func() { flushes++ }
+		Draw(target, matrix, f, c.opts)
+		if got := len(f.drawCache.imds); got != c.want {
+			t.Errorf("%s: built %d line sets, want %d", c.name, got, c.want)
+		}
+		if flushes != c.want {
+			t.Errorf("%s: flushed %d times, want %d", c.name, flushes, c.want)
+		}
+	}
+}
+
+// benchmarkDraw draws depths 1 to 9 of a three point base, about 30,000
+// points, building the lines from scratch each time, unless opts.Retain
+// lets it keep them.
+func benchmarkDraw(b *testing.B, opts DrawOptions) {
+	f, err := newQuietFractal([]Point{
+		{Vec: pixel.Vec{X: 0.3, Y: 0.3}, Color: 100},
+		{Vec: pixel.Vec{X: 0.7, Y: -0.3}, Color: 400},
+		{Vec: pixel.Vec{X: 1}, Color: 700},
+	}, 16)
+	if err != nil {
+		b.Fatalf("new fractal: %s", err)
+	}
+	for f.Depth < 9 {
+		if !f.Render(f.Depth + 1) {
+			b.Fatalf("render depth %d: %v", f.Depth+1, f.renderErr)
+		}
+	}
+	target := pixel.NewBatch(&pixel.TrianglesData{}, nil)
+	matrix := pixel.IM.Scaled(pixel.Vec{}, 500)
+	opts.LineWidth = 1
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Draw(target, matrix, f, opts)
+	}
+}
+
+func BenchmarkDrawPerDepth(b *testing.B) {
+	benchmarkDraw(b, DrawOptions{})
+}
+
+func BenchmarkDrawSinglePass(b *testing.B) {
+	benchmarkDraw(b, DrawOptions{SinglePass: true})
+}
+
+func TestPosterize(t *testing.T) {
+	seen := map[int16]bool{}
+	for c := int16(0); c < 1024; c++ {
+		seen[posterize(c, 4)] = true
+	}
+	if len(seen) != 4 || !seen[0] || !seen[256] || !seen[512] || !seen[768] {
+		t.Errorf("posterizing to 4 gives %v, want 0, 256, 512, and 768", seen)
+	}
+	// the top of the palette is nearest to 0, around the circle
+	for c, want := range map[int16]int16{0: 0, 127: 0, 128: 256, 300: 256, 850: 768, 900: 0} {
+		if got := posterize(c, 4); got != want {
+			t.Errorf("posterize(%d, 4) = %d, want %d", c, got, want)
+		}
+	}
+	if got := posterize(300, 0); got != 300 {
+		t.Errorf("posterize(300, 0) = %d, want it left alone", got)
+	}
+}
+
+// BenchmarkDrawRetained is what a frame costs when nothing's changed: the
+// check that nothing has, and drawing the lines kept from last time.
+func BenchmarkDrawRetained(b *testing.B) {
+	benchmarkDraw(b, DrawOptions{Retain: true})
+}
+
+// TestSameLines changes each field of DrawOptions in turn, and checks that
+// sameLines notices, so a new field can't be forgotten there.
+func TestSameLines(t *testing.T) {
+	ignored := map[string]bool{"Flush": true, "Retain": true}
+	typ := reflect.TypeOf(DrawOptions{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if ignored[field.Name] {
+			continue
+		}
+		var changed DrawOptions
+		v := reflect.ValueOf(&changed).Elem().Field(i)
+		// pixel.RGBA, pixel.Rect, and pixel.Vec all start with a float64
+		for v.Kind() == reflect.Struct {
+			v = v.Field(0)
+		}
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.Int, reflect.Int16:
+			v.SetInt(1)
+		case reflect.Uint64:
+			v.SetUint(1)
+		case reflect.Float64:
+			v.SetFloat(1)
+		default:
+			t.Errorf("%s: don't know how to change a %s", field.Name, v.Kind())
+			continue
+		}
+		if (DrawOptions{}).sameLines(changed) {
+			t.Errorf("changing %s doesn't change the lines", field.Name)
+		}
+	}
+	if !(DrawOptions{}).sameLines(DrawOptions{Retain: true, Flush: func() {}}) {
+		t.Errorf("Retain and Flush shouldn't change the lines")
+	}
+}
+
+func TestDashSpans(t *testing.T) {
+	var got [][2]float64
+	collect := func(t0, t1 float64) {
+		got = append(got, [2]float64{t0, t1})
+	}
+	// dashes and gaps 2 long along a segment 10 long
+	at := 0.0
+	dashSpans(10, 2, &at, collect)
+	want := [][2]float64{{0, 0.2}, {0.4, 0.6}, {0.8, 1}}
+	if !reflect.DeepEqual(got, want) || at != 10 {
+		t.Errorf("dashes along 10: got %v, at %g, want %v, at 10", got, at, want)
+	}
+	// the next segment starts in the gap after the last dash, so its
+	// first dash starts halfway along it
+	got = nil
+	dashSpans(4, 2, &at, collect)
+	want = [][2]float64{{0.5, 1}}
+	if !reflect.DeepEqual(got, want) || at != 14 {
+		t.Errorf("dashes carried on along 4: got %v, at %g, want %v, at 14", got, at, want)
+	}
+	// a dash can be split across segments
+	got = nil
+	at = 1
+	dashSpans(4, 2, &at, collect)
+	want = [][2]float64{{0, 0.25}, {0.75, 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dashes starting 1 in: got %v, want %v", got, want)
+	}
+}
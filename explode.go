@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// explodeTime is how long, in seconds, the explode animation takes to fly
+// apart and come back together.
+const explodeTime = 2.0
+
+// maxExplode is the largest ExplodeMagnitude allows, which moves branches
+// twice the size of the fractal.
+const maxExplode = 2.0
+
+// explodeAmount yields how far the explode animation has got, elapsed
+// seconds in: 0 at the start, 1 halfway through, and back to 0 at the end,
+// easing in and out.
+func explodeAmount(elapsed float64) float64 {
+	if elapsed <= 0 || elapsed >= explodeTime {
+		return 0
+	}
+	return math.Sin(math.Pi * elapsed / explodeTime)
+}
+
+// branchesAt yields, for each point of the given depth, which segment of
+// branchDepth it comes from, following the layout Render uses; see
+// parentIndex.
+func (f *Fractal) branchesAt(branchDepth, depth int) []int {
+	branches := make([]int, len(f.Points(branchDepth)))
+	for i := range branches {
+		branches[i] = i
+	}
+	for d := branchDepth; d < depth; d++ {
+		next := make([]int, 0, len(f.Points(d+1)))
+		for i, p := range f.Points(d) {
+			n := len(f.Base)
+			if p.Flags&Prune != 0 {
+				n = 1
+			}
+			for k := 0; k < n; k++ {
+				next = append(next, branches[i])
+			}
+		}
+		branches = next
+	}
+	return branches
+}
+
+// explodeOffsets yields how far to move each branch, which is each segment
+// of branchDepth along with everything it produces, for an exploded view:
+// away from the centroid, through the middle of the segment, by amount
+// times the size of the fractal.
+func (f *Fractal) explodeOffsets(branchDepth int, amount float64) []pixel.Vec {
+	points := f.Points(branchDepth)
+	center := f.Centroid(branchDepth)
+	distance := amount * f.Bounds.Size().Len()
+	offsets := make([]pixel.Vec, len(points))
+	prev := pixel.Vec{}
+	for i, p := range points {
+		away := pixel.Lerp(prev, p.Vec, 0.5).Sub(center)
+		if l := away.Len(); l > 0 {
+			offsets[i] = away.Scaled(distance / l)
+		}
+		prev = p.Vec
+	}
+	return offsets
+}
+
+// explodedPoints yields the points of the given depth with each branch of
+// branchDepth moved outwards by amount; see explodeOffsets. Where one
+// branch ends and the next starts, a hidden point jumps to the next one's
+// start, so branches come apart rather than being joined by long lines.
+// withOrigin does the same for the first branch, which starts at the
+// origin. Depths shallower than branchDepth have each segment moved on its
+// own. The fractal isn't changed.
+func (f *Fractal) explodedPoints(depth, branchDepth int, amount float64, withOrigin bool) []Point {
+	points := f.Points(depth)
+	if amount == 0 || branchDepth < 1 || len(points) == 0 {
+		return points
+	}
+	if branchDepth > depth {
+		branchDepth = depth
+	}
+	branches := f.branchesAt(branchDepth, depth)
+	offsets := f.explodeOffsets(branchDepth, amount)
+	out := make([]Point, 0, len(points)+len(offsets))
+	for j, p := range points {
+		off := offsets[branches[j]]
+		if j == 0 && withOrigin {
+			out = append(out, Point{Vec: off, Flags: Hide, Color: p.Color})
+		}
+		if j > 0 && branches[j] != branches[j-1] {
+			jump := points[j-1]
+			jump.Vec = jump.Vec.Add(off)
+			jump.Flags |= Hide
+			out = append(out, jump)
+		}
+		p.Vec = p.Vec.Add(off)
+		out = append(out, p)
+	}
+	return out
+}
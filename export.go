@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+
+	"github.com/faiface/pixel"
+	"github.com/sqweek/dialog"
+)
+
+// paletteHeight is the height of the strip ExportPalette writes.
+const paletteHeight = 32
+
+// toNRGBA converts a color table entry to an 8-bit color.
+func toNRGBA(c pixel.RGBA) color.NRGBA {
+	clamp := func(x float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, x)) * 255))
+	}
+	return color.NRGBA{R: clamp(c.R), G: clamp(c.G), B: clamp(c.B), A: clamp(c.A)}
+}
+
+// writePNG writes an image to the named file as a PNG.
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, img)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ExportPalette writes the color table to the named file as a PNG strip,
+// one column per entry.
+func (f *Fractal) ExportPalette(path string) error {
+	img := image.NewNRGBA(image.Rect(0, 0, len(f.colorTab), paletteHeight))
+	for x, c := range f.colorTab {
+		nc := toNRGBA(c)
+		for y := 0; y < paletteHeight; y++ {
+			img.SetNRGBA(x, y, nc)
+		}
+	}
+	return writePNG(path, img)
+}
+
+// ExportPaletteDialog asks where to export the palette, then does it.
+func (f *Fractal) ExportPaletteDialog() {
+	filename, err := dialog.File().Filter("PNG images", "png").Title("Export Palette").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	err = f.ExportPalette(filename)
+	if err != nil {
+		fmt.Printf("export palette: %s\n", err)
+	}
+}
+
+// ExportPNG writes the given depth to the named file as a w by h PNG,
+// supersampled by ssaa and smoothed by smoothPasses; see RenderToImage. A
+// non-zero dpi is recorded in the file, for printing.
+func (f *Fractal) ExportPNG(path string, depth, w, h, ssaa, smoothPasses int, dpi float64) error {
+	img, err := f.RenderToImage(depth, w, h, ssaa, smoothPasses)
+	if err != nil {
+		return err
+	}
+	return writePNGDPI(path, img, dpi)
+}
+
+// ExportPNGDialog asks where to export an image of the current depth, at
+// the logical size, or the print size if -width is set, then does it.
+func (f *Fractal) ExportPNGDialog() {
+	filename, err := dialog.File().Filter("PNG images", "png").Title("Export Image").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	err = f.ExportPNGSized(filename, f.Depth)
+	if err != nil {
+		fmt.Printf("export image: %s\n", err)
+	}
+}
+
+// ExportPNGSized exports the given depth as a PNG at the logical size, or
+// the print size if -width is set, as pixel art if PixelSize is set.
+func (f *Fractal) ExportPNGSized(path string, depth int) error {
+	ps, err := printSize()
+	if err != nil {
+		return err
+	}
+	size := f.Settings.LogicalSize
+	w, h := int(size.X), int(size.Y)
+	if ps.WidthMM != 0 {
+		w, h = ps.Pixels(size)
+	}
+	if f.Settings.PixelSize > 1 {
+		img, err := f.RenderPixelArt(depth, w, h, f.Settings.PixelSize)
+		if err != nil {
+			return err
+		}
+		return writePNGDPI(path, img, ps.DPI)
+	}
+	return f.ExportPNG(path, depth, w, h, f.Settings.ExportSSAA, f.Settings.ExportSmooth, ps.DPI)
+}
+
+// GIFs get a square image of gifSize pixels, and gifDelay hundredths of a
+// second per frame.
+const (
+	gifSize  = 512
+	gifDelay = 4
+)
+
+// gifBins is how many colors of the table a GIF palette can hold, after
+// the background.
+const gifBins = 255
+
+// ExportPaletteGIF writes a looping animated GIF of the given depth with
+// the palette rotating, going all the way around the color table in the
+// given number of frames. The geometry is only drawn once; each frame has
+// the same pixels and its own rotated palette. GIF palettes are limited
+// to 256 colors, so the color table is quantized down to gifBins colors.
+func (f *Fractal) ExportPaletteGIF(path string, depth, frames int) error {
+	if frames < 1 {
+		return fmt.Errorf("export gif: need at least one frame")
+	}
+	img, err := f.rasterize(depth, gifSize, gifSize, 1, 0)
+	if err != nil {
+		return err
+	}
+	// pixel 0 is the background; the rest are bins of the color table
+	pix := make([]uint8, len(img.pix))
+	for i, c := range img.pix {
+		if c >= 0 {
+			pix[i] = uint8(1 + int(c)*gifBins/1024)
+		}
+	}
+	anim := &gif.GIF{LoopCount: 0}
+	bounds := image.Rect(0, 0, img.w, img.h)
+	for i := 0; i < frames; i++ {
+		shift := i * 1024 / frames
+		palette := make(color.Palette, gifBins+1)
+		palette[0] = color.Black
+		for bin := 0; bin < gifBins; bin++ {
+			palette[1+bin] = toNRGBA(f.colorTab[(bin*1024/gifBins+shift)%1024])
+		}
+		frame := image.NewPaletted(bounds, palette)
+		copy(frame.Pix, pix)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, gifDelay)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = gif.EncodeAll(file, anim)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// gifFrames is how many frames ExportPaletteGIFDialog asks for.
+const gifFrames = 64
+
+// ExportPaletteGIFDialog asks where to export a palette rotation GIF of
+// the current depth, then does it.
+func (f *Fractal) ExportPaletteGIFDialog() {
+	filename, err := dialog.File().Filter("GIF images", "gif").Title("Export Palette Animation").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	err = f.ExportPaletteGIF(filename, f.Depth, gifFrames)
+	if err != nil {
+		fmt.Printf("export gif: %s\n", err)
+	}
+}
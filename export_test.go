@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// readPNGFile decodes the named PNG file.
+func readPNGFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	return img
+}
+
+func TestExportPalette(t *testing.T) {
+	f := testFractal(t, tentBase())
+	path := filepath.Join(t.TempDir(), "palette.png")
+	if err := f.ExportPalette(path); err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	img := readPNGFile(t, path)
+	b := img.Bounds()
+	if b.Dx() != len(f.colorTab) || b.Dy() != paletteHeight {
+		t.Fatalf("palette is %dx%d, want %dx%d", b.Dx(), b.Dy(), len(f.colorTab), paletteHeight)
+	}
+	for _, x := range []int{0, len(f.colorTab) - 1} {
+		want := f.colorTab[x]
+		r, g, bl, _ := img.At(x, paletteHeight/2).RGBA()
+		got := []float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(bl) / 0xffff}
+		for i, w := range []float64{want.R, want.G, want.B} {
+			if math.Abs(got[i]-w) > 1.0/255 {
+				t.Errorf("column %d: channel %d is %.3f, want %.3f", x, i, got[i], w)
+			}
+		}
+	}
+}
+
+func TestExportPaletteGIF(t *testing.T) {
+	f := testFractal(t, tentBase())
+	path := filepath.Join(t.TempDir(), "palette.gif")
+	const frames = 6
+	if err := f.ExportPaletteGIF(path, 3, frames); err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer file.Close()
+	anim, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if len(anim.Image) != frames {
+		t.Errorf("%d frames, want %d", len(anim.Image), frames)
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("loop count %d, want 0, forever", anim.LoopCount)
+	}
+	if err := f.ExportPaletteGIF(path, 3, 0); err == nil {
+		t.Errorf("no frames: expected an error")
+	}
+}
+
+// svgLayers reads an SVG file and returns the ids of the groups in it
+// which have one, in order, along with how many polylines each has.
+func svgLayers(t *testing.T, path string) ([]string, map[string]int) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var ids []string
+	lines := map[string]int{}
+	// the ids of the groups the decoder is in, innermost last
+	var open []string
+	dec := xml.NewDecoder(file)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "g":
+				id := ""
+				for _, attr := range tok.Attr {
+					if attr.Name.Local == "id" {
+						id = attr.Value
+						ids = append(ids, id)
+					}
+				}
+				open = append(open, id)
+			case "polyline":
+				if len(open) > 0 {
+					lines[open[len(open)-1]]++
+				}
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "g" {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return ids, lines
+}
+
+func TestExportSVGLayered(t *testing.T) {
+	f := testFractal(t, tentBase())
+	dir := t.TempDir()
+	layered := filepath.Join(dir, "layered.svg")
+	if err := f.ExportSVG(layered, true, 0, 0); err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	ids, lines := svgLayers(t, layered)
+	if len(ids) != f.Depth {
+		t.Fatalf("%d depths rendered, but %d groups: %v", f.Depth, len(ids), ids)
+	}
+	for i, id := range ids {
+		if want := fmt.Sprintf("depth-%d", i+1); id != want {
+			t.Errorf("group %d is %q, want %q", i, id, want)
+		}
+		if lines[id] == 0 {
+			t.Errorf("group %q has no lines in it", id)
+		}
+	}
+	flat := filepath.Join(dir, "flat.svg")
+	if err := f.ExportSVG(flat, false, 0, 0); err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	if ids, _ := svgLayers(t, flat); len(ids) != 0 {
+		t.Errorf("unlayered export has groups %v", ids)
+	}
+}
+
+func TestWritePNGDPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "print.png")
+	if err := writePNGDPI(path, image.NewNRGBA(image.Rect(0, 0, 4, 4)), 300); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	// it's still a PNG as far as image/png is concerned
+	if img := readPNGFile(t, path); img.Bounds().Dx() != 4 {
+		t.Errorf("decoded image is %v, want 4x4", img.Bounds())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// walk the chunks after the signature, checking each one's CRC
+	found := false
+	for at := 8; at+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[at:]))
+		if at+12+n > len(data) {
+			t.Fatalf("chunk at %d runs past the end", at)
+		}
+		kind, body := string(data[at+4:at+8]), data[at+8:at+8+n]
+		if crc := binary.BigEndian.Uint32(data[at+8+n:]); crc != crc32.ChecksumIEEE(data[at+4:at+8+n]) {
+			t.Errorf("%s chunk has a bad CRC", kind)
+		}
+		if kind == "pHYs" {
+			found = true
+			// 300 dots an inch is 11811 a meter
+			x, y := binary.BigEndian.Uint32(body), binary.BigEndian.Uint32(body[4:])
+			if n != 9 || x != 11811 || y != 11811 || body[8] != 1 {
+				t.Errorf("pHYs is %d, %d per unit %d, want 11811 per meter", x, y, body[8])
+			}
+		}
+		at += 12 + n
+	}
+	if !found {
+		t.Errorf("no pHYs chunk")
+	}
+}
+
+func TestExportGeoJSON(t *testing.T) {
+	f := testFractal(t, tentBase())
+	path := filepath.Join(t.TempDir(), "curve.geojson")
+	if err := f.ExportGeoJSON(path, 2); err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feature geoFeature
+	if err := json.Unmarshal(data, &feature); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	if feature.Type != "Feature" || feature.Geometry.Type != "LineString" {
+		t.Errorf("exported a %q with a %q, want a Feature with a LineString", feature.Type, feature.Geometry.Type)
+	}
+	// depth 2 is four points, and the origin starts the line
+	want := [][2]float64{{0, 0}, {0, 0.5}, {0.5, 0.5}, {1, 0.5}, {1, 0}}
+	got := feature.Geometry.Coordinates
+	if len(got) != len(want) {
+		t.Fatalf("%d coordinates, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i][0]-want[i][0]) > 1e-9 || math.Abs(got[i][1]-want[i][1]) > 1e-9 {
+			t.Errorf("coordinate %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestExportTileEdges exports a tile of a base with vertical segments
+// along the left and right edges of its bounds, at different heights. The
+// lines going off either edge come back on the other, so the edge columns
+// match: wherever one is drawn, so is the other, give or take a row where
+// the slanted segment joining them meets them.
+func TestExportTileEdges(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: -0.25}},
+		{Vec: pixel.Vec{X: -0.25, Y: 0.25}},
+		{Vec: pixel.Vec{X: 1, Y: 0.5}},
+		{Vec: pixel.Vec{X: 1, Y: 0.75}},
+	}
+	f := testFractal(t, base)
+	f.Settings.ExportSmooth = 0
+	path := filepath.Join(t.TempDir(), "tile.png")
+	if err := f.ExportTile(path, 1, 64); err != nil {
+		t.Fatalf("export tile: %v", err)
+	}
+	img := readPNGFile(t, path)
+	b := img.Bounds()
+	drawn := func(x, y int) bool {
+		if y < b.Min.Y || y >= b.Max.Y {
+			return false
+		}
+		r, g, b, _ := img.At(x, y).RGBA()
+		return r|g|b != 0
+	}
+	near := func(x, y int) bool {
+		return drawn(x, y-1) || drawn(x, y) || drawn(x, y+1)
+	}
+	left, right := b.Min.X, b.Max.X-1
+	rows := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if drawn(left, y) && !near(right, y) {
+			t.Errorf("row %d: left edge drawn, right edge isn't", y)
+		}
+		if drawn(right, y) && !near(left, y) {
+			t.Errorf("row %d: right edge drawn, left edge isn't", y)
+		}
+		if drawn(left, y) {
+			rows++
+		}
+	}
+	if rows == 0 {
+		t.Errorf("nothing drawn at the edges")
+	}
+}
+
+func TestImportSVGPath(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, d string) string {
+		path := filepath.Join(dir, name)
+		svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg"><path d="%s"/></svg>`, d)
+		if err := writeSaved(path, []byte(svg)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	// four segments: a relative line, a horizontal one, a move, and a line;
+	// SVG's Y goes down, so the path goes up from its start
+	base, err := ImportSVGPath(write("path.svg", "M 10 10 l 10 -10 h 10 M 40 10 L 50 10"))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	want := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.25}, Color: 0},
+		{Vec: pixel.Vec{X: 0.5, Y: 0.25}, Color: 128},
+		{Vec: pixel.Vec{X: 0.75}, Color: 256, Flags: Hide},
+		{Vec: pixel.Vec{X: 1}, Color: 384},
+	}
+	if len(base) != len(want) {
+		t.Fatalf("imported %d points, want %d", len(base), len(want))
+	}
+	for i, p := range base {
+		w := want[i]
+		if p.Vec.Sub(w.Vec).Len() > 1e-9 || p.Color != w.Color || p.Flags != w.Flags {
+			t.Errorf("point %d: got %v, color %d, flags %v, want %v, color %d, flags %v",
+				i, p.Vec, p.Color, p.Flags, w.Vec, w.Color, w.Flags)
+		}
+	}
+	for _, d := range []string{"M 0 0 C 1 1 2 2 3 0", "M 0 0 L 1 1 Z", "M 0 0"} {
+		if _, err := ImportSVGPath(write("bad.svg", d)); err == nil {
+			t.Errorf("importing %q didn't fail", d)
+		}
+	}
+}
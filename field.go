@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// textField is a minimal line of keyboard input, shown in the overlay.
+// While it has focus, typed keys go to it rather than to the keybindings.
+type textField struct {
+	focused bool
+	text    string
+	// allowed is the set of characters the field accepts.
+	allowed string
+	// accept is called with the text when Enter is pressed.
+	accept func(text string)
+}
+
+// Focus starts a new entry in the field.
+func (t *textField) Focus(accept func(text string)) {
+	t.focused = true
+	t.text = ""
+	t.accept = accept
+}
+
+// Update takes this frame's input, if the field has focus, and reports
+// whether it did, in which case the keys shouldn't be used for anything else.
+func (t *textField) Update(win *pixelgl.Window) bool {
+	if !t.focused {
+		return false
+	}
+	for _, r := range win.Typed() {
+		if strings.ContainsRune(t.allowed, r) {
+			t.text += string(r)
+		}
+	}
+	if (win.JustPressed(pixelgl.KeyBackspace) || win.Repeated(pixelgl.KeyBackspace)) && len(t.text) > 0 {
+		t.text = t.text[:len(t.text)-1]
+	}
+	switch {
+	case win.JustPressed(pixelgl.KeyEscape):
+		t.focused = false
+	case win.JustPressed(pixelgl.KeyEnter) || win.JustPressed(pixelgl.KeyKPEnter):
+		t.focused = false
+		if t.accept != nil {
+			t.accept(t.text)
+		}
+	}
+	return true
+}
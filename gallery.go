@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// Gallery thumbnails get this point budget and are drawn to this depth,
+// which is plenty to judge a variation by.
+const (
+	thumbOOM   = 14
+	thumbDepth = 6
+	thumbGap   = 8.0
+)
+
+// gallery is a grid of thumbnails of random variations on a base, shown
+// over the canvas, for exploring. The variations come from a seed, so the
+// same seed gives the same gallery.
+type gallery struct {
+	bases   [][]Point
+	sprites []*pixel.Sprite
+	cells   []pixel.Rect
+}
+
+// jitterBase returns a copy of base with each point moved at random by up
+// to amount in each direction, and its color changed by up to amount*1024
+// entries. The last point stays put, since it's the end of the curve.
+func jitterBase(base []Point, rng *rand.Rand, amount float64) []Point {
+	out := make([]Point, len(base))
+	copy(out, base)
+	for i := range out[:len(out)-1] {
+		out[i].X += (rng.Float64()*2 - 1) * amount
+		out[i].Y += (rng.Float64()*2 - 1) * amount
+		out[i].Color = modPlus(out[i].Color+int16((rng.Float64()*2-1)*amount*1024), 1024)
+	}
+	return out
+}
+
+// newGallery makes an n by n gallery of variations on f, jittered by the
+// given amount, laid out in rect.
+func newGallery(f *Fractal, rect pixel.Rect, n int, jitter float64, seed int64) *gallery {
+	g := &gallery{}
+	rng := rand.New(rand.NewSource(seed))
+	cellSize := math.Min(rect.W(), rect.H()) / float64(n)
+	size := int(cellSize - thumbGap)
+	origin := rect.Center().Sub(pixel.V(cellSize, cellSize).Scaled(float64(n) / 2))
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			base := jitterBase(f.Base, rng, jitter)
+			min := origin.Add(pixel.V(float64(col)*cellSize, float64(n-1-row)*cellSize))
+			cell := pixel.Rect{Min: min, Max: min.Add(pixel.V(cellSize, cellSize))}
+			pic := pixel.PictureDataFromImage(f.thumbnail(base, size))
+			g.bases = append(g.bases, base)
+			g.sprites = append(g.sprites, pixel.NewSprite(pic, pic.Bounds()))
+			g.cells = append(g.cells, cell)
+		}
+	}
+	return g
+}
+
+// thumbnail renders a small picture of the fractal generated by base, with
+// f's modes and colors.
+func (f *Fractal) thumbnail(base []Point, size int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	t, err := newQuietFractal(base, thumbOOM)
+	if err != nil {
+		return img
+	}
+	t.InverseMode = f.InverseMode
+	t.FlagMode = f.FlagMode
+	t.ColorMode = f.ColorMode
+	t.WrapMode = f.WrapMode
+	t.GlobalFixedColor = f.GlobalFixedColor
+	t.Root = f.Root
+	t.colorTab = f.colorTab
+	t.Changed()
+	depth := thumbDepth
+	if depth > t.MaxDepth-1 {
+		depth = t.MaxDepth - 1
+	}
+	indices, err := t.rasterize(depth, size, size, 1, 0)
+	if err != nil {
+		return img
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if c := indices.at(x, y); c >= 0 {
+				img.Set(x, y, toNRGBA(f.colorTab[c]))
+			}
+		}
+	}
+	return img
+}
+
+// Draw draws the thumbnails.
+func (g *gallery) Draw(t pixel.Target) {
+	for i, s := range g.sprites {
+		s.Draw(t, pixel.IM.Moved(g.cells[i].Center()))
+	}
+}
+
+// Hit returns the index of the thumbnail at pos, or -1.
+func (g *gallery) Hit(pos pixel.Vec) int {
+	for i, cell := range g.cells {
+		if cell.Contains(pos) {
+			return i
+		}
+	}
+	return -1
+}
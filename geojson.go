@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/faiface/pixel"
+	"github.com/sqweek/dialog"
+)
+
+// geoFeature is just enough of GeoJSON for a single line.
+type geoFeature struct {
+	Type       string            `json:"type"`
+	Geometry   geoLineString     `json:"geometry"`
+	Properties map[string]string `json:"properties"`
+}
+
+type geoLineString struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+// ExportGeoJSON writes the curve at the given depth, clamped to the depths
+// rendered so far, to the named file as a GeoJSON LineString feature.
+// Like the SVG export, it starts at the origin only with DrawOriginSegment.
+// A LineString can't have gaps, so hidden segments are included. With
+// -geofit, the coordinates are scaled and centered to fit longitudes from
+// -180 to 180 and latitudes from -90 to 90; otherwise they're fractal
+// units.
+func (f *Fractal) ExportGeoJSON(path string, depth int) error {
+	if f.Depth < 1 {
+		return errors.New("export geojson: nothing rendered yet")
+	}
+	if depth > f.Depth {
+		depth = f.Depth
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	points := f.Points(depth)
+	coords := make([][2]float64, 0, len(points)+1)
+	if f.Settings.DrawOriginSegment {
+		coords = append(coords, [2]float64{0, 0})
+	}
+	for _, p := range points {
+		coords = append(coords, [2]float64{p.X, p.Y})
+	}
+	scale, center := 1.0, pixel.Vec{}
+	if *geoFit {
+		b := f.BoundsAt(depth)
+		scale = math.Min(360/math.Max(b.W(), 1e-9), 180/math.Max(b.H(), 1e-9))
+		center = b.Center()
+	}
+	for i, c := range coords {
+		coords[i][0] = (c[0] - center.X) * scale
+		coords[i][1] = (c[1] - center.Y) * scale
+		if f.Settings.FlipYOutput {
+			coords[i][1] = -coords[i][1]
+		}
+	}
+	feature := geoFeature{
+		Type:       "Feature",
+		Geometry:   geoLineString{Type: "LineString", Coordinates: coords},
+		Properties: map[string]string{"depth": fmt.Sprint(depth)},
+	}
+	jsonstr, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	return writeSaved(path, jsonstr)
+}
+
+// ExportGeoJSONDialog asks where to export the current depth as GeoJSON,
+// then does it.
+func (f *Fractal) ExportGeoJSONDialog() {
+	filename, err := dialog.File().Filter("GeoJSON", "geojson", "json").Title("Export GeoJSON").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	err = f.ExportGeoJSON(filename, f.Depth)
+	if err != nil {
+		fmt.Printf("export geojson: %s\n", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// highlightFlash is how long each of the two highlight colors shows for.
+const highlightFlash = 125 * time.Millisecond
+
+// snapshotChanges keeps a copy of the focus depth's points, as they are
+// before an edit, to compare with afterwards, if change highlighting is on.
+func (f *Fractal) snapshotChanges() {
+	depth := f.Settings.FocusDepth
+	if !f.Settings.HighlightChanges || depth > f.Depth || f.changesBefore != nil {
+		return
+	}
+	points := f.Points(depth)
+	f.changesBefore = make([]Point, len(points))
+	copy(f.changesBefore, points)
+	f.changesDepth = depth
+}
+
+// updateChanges compares the snapshot from before an edit with the same
+// depth now, once it's been rendered again, and starts highlighting the
+// segments which moved. It waits while editing is still going on.
+func (f *Fractal) updateChanges(editing bool) {
+	if f.changesBefore == nil || editing || f.Depth < f.changesDepth {
+		return
+	}
+	threshold := f.Settings.ChangeThreshold * f.Bounds.Size().Len()
+	f.changed = ChangedSegments(f.changesBefore, f.Points(f.changesDepth), threshold)
+	f.changedAt = time.Now()
+	f.changesBefore = nil
+}
+
+// ChangedSegments yields the indices of the segments, named by the point
+// ending each, which moved by more than threshold from before to after:
+// either end moving counts. The first segment starts at the origin, which
+// never moves. If the number of points changed, they can't be matched up,
+// so every segment counts.
+func ChangedSegments(before, after []Point, threshold float64) []int {
+	var changed []int
+	if len(before) != len(after) {
+		for i := range after {
+			changed = append(changed, i)
+		}
+		return changed
+	}
+	moved := func(i int) bool {
+		return i >= 0 && after[i].Sub(before[i].Vec).Len() > threshold
+	}
+	for i := range after {
+		if moved(i) || moved(i-1) {
+			changed = append(changed, i)
+		}
+	}
+	return changed
+}
+
+// DrawChanges draws the changed segments, flashing, until the highlight
+// duration runs out. It returns false if there's nothing to draw.
+func (f *Fractal) DrawChanges(target pixel.Target, imd *imdraw.IMDraw, matrix pixel.Matrix) bool {
+	since := time.Since(f.changedAt)
+	if len(f.changed) == 0 || since.Seconds() > f.Settings.ChangeTime {
+		f.changed = nil
+		return false
+	}
+	points := f.Points(f.changesDepth)
+	if points == nil {
+		return false
+	}
+	imd.Clear()
+	imd.SetMatrix(matrix)
+	imd.Color = pixel.RGBA{R: 1, G: 1, B: 1, A: 1}
+	if (since/highlightFlash)%2 != 0 {
+		imd.Color = pixel.RGBA{R: 1, G: .2, B: .2, A: 1}
+	}
+	width := 4 / matrix[0]
+	for _, i := range f.changed {
+		if i >= len(points) {
+			continue
+		}
+		prev := pixel.Vec{}
+		if i > 0 {
+			prev = points[i-1].Vec
+		}
+		imd.Push(prev, points[i].Vec)
+		imd.Line(width)
+	}
+	imd.Draw(target)
+	return true
+}
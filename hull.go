@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// ConvexHull yields the convex hull of the curve at the given depth,
+// which is clamped to the depths rendered so far, counterclockwise from
+// the leftmost point (the lowest, if there's a tie). The curve starts at
+// the origin, which isn't one of the points, so it's added. Points on an
+// edge of the hull aren't included, so if the curve is all on one line,
+// the hull is just its two ends, and if it's all in one place, it's that
+// one point. It uses Andrew's monotone chain algorithm.
+func (f *Fractal) ConvexHull(depth int) []pixel.Vec {
+	if depth > f.Depth {
+		depth = f.Depth
+	}
+	if depth < 0 {
+		depth = 0
+	}
+	points := f.Points(depth)
+	if len(points) == 0 {
+		return nil
+	}
+	vs := make([]pixel.Vec, 1, len(points)+1)
+	for _, p := range points {
+		vs = append(vs, p.Vec)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		if vs[i].X != vs[j].X {
+			return vs[i].X < vs[j].X
+		}
+		return vs[i].Y < vs[j].Y
+	})
+	// cross is positive if o, a, b turn counterclockwise
+	cross := func(o, a, b pixel.Vec) float64 {
+		return a.Sub(o).Cross(b.Sub(o))
+	}
+	hull := make([]pixel.Vec, 0, 2*len(vs))
+	// the lower hull, left to right
+	for _, v := range vs {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], v) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, v)
+	}
+	// the upper hull, right to left
+	lower := len(hull) + 1
+	for i := len(vs) - 2; i >= 0; i-- {
+		v := vs[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], v) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, v)
+	}
+	// the last point is the first one again
+	hull = hull[:len(hull)-1]
+	if len(hull) == 2 && hull[0] == hull[1] {
+		hull = hull[:1]
+	}
+	return hull
+}
+
+// DrawHull outlines the convex hull of the given depth, in lines width
+// target pixels wide, to show how much of its bounds it actually fills.
+func DrawHull(target pixel.Target, matrix pixel.Matrix, frac *Fractal, depth int, width float64) {
+	hull := frac.ConvexHull(depth)
+	if len(hull) < 2 {
+		return
+	}
+	if drawIMD == nil {
+		drawIMD = imdraw.New(nil)
+	}
+	imd := drawIMD
+	imd.SetMatrix(matrix)
+	imd.Clear()
+	imd.Color = pixel.RGBA{R: .6, G: .6, B: .6, A: 1}
+	imd.Push(hull...)
+	imd.Push(hull[0])
+	imd.Line(width / matrix[0])
+	imd.Draw(target)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// runningMutex is the lock on every Fractal. Anything which changes a
+// fractal, which is to say the edit methods, Changed, Alloc, and Render,
+// must be called with it held, as must anything reading one that might be
+// being changed at the same time. The methods don't take it themselves,
+// since they call each other; the caller takes it once, around the whole
+// operation.
+//
+// In practice, main takes it at the start, so the headless modes and the
+// display loop have it throughout, and the display loop lets go of it only
+// while it waits for the next frame. A goroutine which wants to look at a
+// fractal uses withFractals, and gets its turn between frames. The
+// goroutines there are now don't need it: autosave only writes out JSON
+// marshaled on the display loop, and the stats server reads its own copy
+// under statsMu.
+var runningMutex sync.Mutex
+
+// mustHold panics, with -checklocks, if runningMutex isn't held, so that a
+// goroutine changing a fractal without it shows up right away, rather than
+// as the occasional corrupt render. A mutex doesn't know who holds it, so
+// this can't tell whether the caller is the one holding it, only that
+// someone is.
+func mustHold(what string) {
+	if !*checkLocks {
+		return
+	}
+	if runningMutex.TryLock() {
+		runningMutex.Unlock()
+		panic(fmt.Sprintf("%s called without holding runningMutex", what))
+	}
+}
+
+// withFractals runs fn with runningMutex held, for goroutines other than
+// the display loop which need to look at, or change, a fractal.
+func withFractals(fn func()) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	fn()
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/faiface/pixel"
@@ -20,6 +25,7 @@ import (
 	"github.com/sqweek/dialog"
 
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
 )
 
 // flags
@@ -29,12 +35,98 @@ const (
 	FlipX
 	FlipY
 	FixedC
+	HasColor2
+	Dashed
+	allFlags = (1 << iota) - 1
 )
 
+// Inverse modes, which control how Changed derives the inverse base that
+// FlipX segments are drawn with. All of them reverse the order of the
+// non-position values.
+//
+// InverseReflectX mirrors the base around X=0.5, so the curve is traced
+// backwards from {1,0} to {0,0}; a bump above the line stays above it.
+// InverseReflectXY also mirrors it around Y=0, which is a half turn around
+// {0.5,0}; a bump above the line ends up below it, at the other end.
+// InverseReverse leaves positions alone, so only colors and flags run
+// backwards.
+const (
+	InverseReflectX = iota
+	InverseReflectXY
+	InverseReverse
+	inverseModes
+)
+
+var inverseModeNames = [inverseModes]string{"ReflectX", "ReflectXY", "Reverse"}
+
+// Flag modes, which control how a segment's FlipX and FlipY flags combine
+// with the flags of the points generated from it. With FlagsXor, flips
+// toggle, so a flipped segment inside a flipped segment comes out unflipped.
+// With FlagsOr, flips accumulate, so once something is flipped, everything
+// under it stays flipped.
+const (
+	FlagsXor = iota
+	FlagsOr
+	flagModes
+)
+
+var flagModeNames = [flagModes]string{"XOR", "OR"}
+
+// Color modes, which control how points get colors. ColorAccumulate is the
+// usual thing, where each point's color is added to the colors of the
+// points generated from it. ColorByDepth ignores point colors when drawing,
+// and gives each depth its own color instead. ColorAnchorInterp treats the
+// FixedC points as anchors, and gives the points between them colors
+// interpolated between the anchors' colors; nothing accumulates, so every
+// copy of the base gets the same gradient. ColorPinned makes the base
+// colors authoritative: every point inherits the color of the depth 1
+// point it descends from, so the base's colors are the only ones used.
+const (
+	ColorAccumulate = iota
+	ColorByDepth
+	ColorAnchorInterp
+	ColorPinned
+	colorModes
+)
+
+var colorModeNames = [colorModes]string{"Accumulate", "ByDepth", "AnchorInterp", "Pinned"}
+
+// Wrap modes, which control what happens when accumulated colors run off
+// the end of the color table. WrapAround starts again from the beginning,
+// which can make for an abrupt jump. WrapClamp stops at the ends.
+// WrapPingPong reflects back off the ends, so colors keep changing
+// smoothly however deep it goes.
+const (
+	WrapAround = iota
+	WrapClamp
+	WrapPingPong
+	wrapModes
+)
+
+var wrapModeNames = [wrapModes]string{"Wrap", "Clamp", "PingPong"}
+
+// Global fixed color modes, which override the FixedC flag for the whole
+// base, to compare the two without toggling every point. FixedPerPoint
+// goes by each point's flag. FixedAll treats every point as FixedC, so
+// colors are absolute, and FixedNone treats none of them as FixedC, so
+// colors all accumulate.
+const (
+	FixedPerPoint = iota
+	FixedAll
+	FixedNone
+	globalFixedModes
+)
+
+var globalFixedNames = [globalFixedModes]string{"PerPoint", "AllFixed", "AllAccumulate"}
+
 const (
 	debuggingPrunes = 0
 )
 
+// MaxBasePoints caps the number of points in a base; every point multiplies
+// the number of points at each depth.
+var MaxBasePoints = 6
+
 // Mouse activity states. A button starts out Unpressed, then is Pressed,
 // may experience Dragging, and is either Unpressed (event cancelled) or
 // Released (callback happens).
@@ -45,6 +137,15 @@ const (
 	Dragging
 )
 
+// Drag axis locks. A drag can move freely, only along one axis, or along
+// whichever axis it first moves further on.
+const (
+	dragFree = iota
+	dragXOnly
+	dragYOnly
+	dragDominant
+)
+
 var (
 	face         font.Face
 	atlas        *text.Atlas
@@ -57,24 +158,63 @@ type Point struct {
 	pixel.Vec
 	Flags int
 	Color int16
+	// Color2, with the HasColor2 flag, makes the segment ending at this
+	// point a gradient from Color to Color2, whatever its neighbors'
+	// colors are. Without it, the segment blends from the previous
+	// point's color to Color.
+	Color2 int16 `json:",omitempty"`
 }
 
 func (p Point) String() string {
+	if p.Flags&HasColor2 != 0 {
+		return fmt.Sprintf("%.3f, %.3f, 0x%03x, %d-%d", p.X, p.Y, p.Flags, p.Color, p.Color2)
+	}
 	return fmt.Sprintf("%.3f, %.3f, 0x%03x, %d", p.X, p.Y, p.Flags, p.Color)
 }
 
+// EndColor is the color the segment ending at p ends with, which the next
+// segment starts from.
+func (p Point) EndColor() int16 {
+	if p.Flags&HasColor2 != 0 {
+		return p.Color2
+	}
+	return p.Color
+}
+
 // Fractal represents both the underlying data and the current rendered state,
 // which in retrospect is a bad decision.
 type Fractal struct {
-	MaxDepth   int
-	Base       []Point
-	RenderData `json:"-"` // don't try to log all this junk
+	MaxDepth int
+	// MaxOOM is the log2 of the point budget. Files from before it was
+	// saved have 0, which leaves the budget as it was.
+	MaxOOM      uint
+	Base        []Point
+	InverseMode int
+	FlagMode    int
+	ColorMode   int
+	WrapMode    int
+	Settings    Settings
+	RenderData  `json:"-"` // don't try to log all this junk
+
+	// Root is the end of the depth 0 segment, which starts at the origin.
+	// Every depth is a transformed copy of the base, so moving it moves
+	// the whole fractal.
+	Root Point
+
+	// GlobalFixedColor is one of the global fixed color modes, which can
+	// override every point's FixedC flag.
+	GlobalFixedColor int
+
+	// ColorDepthWeight, if non-nil, scales how much a segment's color
+	// contributes to the points generated from it at a given depth. nil
+	// is the same as always returning 1.
+	ColorDepthWeight func(depth int) float64 `json:"-"`
 }
 
 // RenderData is the rendered/computed data for the fractal.
 type RenderData struct {
-	MaxOOM        uint
 	Total         int
+	Totals        []int // cumulative points through each depth, from Alloc
 	selectedPoint int
 	Inverse       []Point
 	Depth         int
@@ -84,33 +224,188 @@ type RenderData struct {
 	Bounds        pixel.Rect
 	colorTab      []pixel.RGBA
 	verbose       bool
+	quiet         bool // don't print allocation details, for fractals nobody's editing
+	undo          []undoEntry
+	sizes         []float64 // diagonal of BoundsAt(depth), once rendered
+	anchorColors  []int16   // base colors for ColorAnchorInterp
+	nonFinite     bool      // a base point is NaN or infinite, so don't render
+	multiSelect   []int     // several selected points, for operations to apply to together
+	renderTimes   []time.Duration
+	inverseView   *Fractal // the fractal generated by Inverse, if shown
+	coincident    [][2]int // pairs of base points in the same place
+	generation    uint64   // bumped whenever rendered points change
+	overflow      int      // points one more depth would have needed, if that's what stopped Alloc
+	drawCache     drawCache
+	streamCache   streamCache
+	pixelArt      pixelArtView
+	mirror        map[int]int // pairs of base points kept mirrored, both ways round
+	mirrorLen     int         // the base length the pairs were made for
+	// changesBefore is the focus depth before an edit, until it can be
+	// compared with after, and changed is the segments which moved.
+	changesBefore []Point
+	changesDepth  int
+	changed       []int
+	changedAt     time.Time
+	renderErr     error // why the last Render failed, if it did
+	session       *sessionLog
+	reference     []Point // a base stashed to compare with, for SwapReference
+	referenceOn   bool    // the base is the reference, and the working base is stashed
+	trace         []int   // the segment traced by TraceAncestors, by ancestorIndices
 }
 
 // Changed causes re-rendering of a fractal.
 func (f *Fractal) Changed() {
+	mustHold("Changed")
+	f.generation++
+	f.trace = nil
 	// compute an inverted base.
 	// first point is the last point's non-position values, and the next-to-last point's
 	// location, with X flipped around 0-1, etcetera, last point is the first point's
-	// values and {1, 0}
+	// values and {1, 0}. InverseMode can change what happens to the location.
 	prev := pixel.Vec{}
 	f.Inverse = make([]Point, len(f.Base))
 	for i, p := range f.Base {
-		p.Vec, prev = pixel.Vec{X: 1 - prev.X, Y: prev.Y}, p.Vec
+		switch f.InverseMode {
+		case InverseReflectXY:
+			p.Vec, prev = pixel.Vec{X: 1 - prev.X, Y: -prev.Y}, p.Vec
+		case InverseReverse:
+			p.Vec = f.Base[len(f.Base)-1-i].Vec
+		default:
+			p.Vec, prev = pixel.Vec{X: 1 - prev.X, Y: prev.Y}, p.Vec
+		}
+		// gradients run the other way, too
+		if p.Flags&HasColor2 != 0 {
+			p.Color, p.Color2 = p.Color2, p.Color
+		}
 		f.Inverse[len(f.Base)-1-i] = p
 	}
+	f.anchorColors = f.AnchorColors()
+	f.nonFinite = f.NonFinite() >= 0
+	f.coincident = f.CoincidentPoints()
+	f.updateInverseView()
 	f.Depth = 0
-	f.Bounds = pixel.Rect{Min: pixel.Vec{}, Max: pixel.Vec{X: 1}}
-	f.Render(0)
-	f.Render(1)
-	f.Render(2)
-	f.Render(3)
-	f.Render(4)
-	f.Render(5)
+	f.Bounds = f.rootBounds()
+	// a failed render capped MaxDepth; this might be the edit that fixes it
+	if len(f.Totals) > 0 {
+		f.MaxDepth = len(f.Totals)
+	}
+	f.renderErr = nil
+	f.prerender()
+}
+
+// updateInverseView keeps the fractal generated by the inverse base up to
+// date, if it's being shown. It's reused until the storage needs to be
+// reallocated, since Changed happens every frame of a drag.
+func (f *Fractal) updateInverseView() {
+	if !f.Settings.ShowInverse {
+		f.inverseView = nil
+		return
+	}
+	base := make([]Point, len(f.Inverse))
+	copy(base, f.Inverse)
+	v := f.inverseView
+	if v == nil {
+		// f.MaxOOM is always one NewFractal allows, so this can't fail
+		v, _ = newQuietFractal(base, f.MaxOOM)
+		v.colorTab = f.colorTab
+	}
+	v.Base = base
+	v.InverseMode = f.InverseMode
+	v.FlagMode = f.FlagMode
+	v.ColorMode = f.ColorMode
+	v.WrapMode = f.WrapMode
+	v.GlobalFixedColor = f.GlobalFixedColor
+	v.Root = f.Root
+	v.Changed()
+	f.inverseView = v
+}
+
+// ShowInverseChange toggles showing the fractal generated by the inverse
+// base, overlaid on this one, which shows what FlipX is substituting.
+func (f *Fractal) ShowInverseChange() {
+	f.Settings.ShowInverse = !f.Settings.ShowInverse
+	f.Changed()
+}
+
+// prerender renders the first few depths, as many as PrerenderDepth says,
+// leaving the rest to be filled in as the display loop gets to them.
+func (f *Fractal) prerender() {
+	for i := 0; i <= f.Settings.PrerenderDepth && i < f.MaxDepth; i++ {
+		if !f.Render(i) {
+			f.renderFailed(i)
+			break
+		}
+	}
+}
+
+// renderFailed reports why depth didn't render, and caps MaxDepth at the
+// depth that did, so nothing goes on to render or draw from the unrendered
+// lines. Changed lifts the cap.
+func (f *Fractal) renderFailed(depth int) {
+	fmt.Printf("oops, render %d failed: %v; stopping at depth %d\n", depth, f.renderErr, f.Depth)
+	f.MaxDepth = f.Depth + 1
+}
+
+// NonFinite returns the index of the first base point with a NaN or
+// infinite coordinate, or -1 if they're all finite. Such a point would
+// turn every affine built from it, and so the whole render, into garbage.
+func (f *Fractal) NonFinite() int {
+	for i, p := range f.Base {
+		if !finite(p.Vec) {
+			return i
+		}
+	}
+	return -1
+}
+
+// CoincidentPoints returns the index pairs of consecutive base points which
+// are in exactly the same place, with -1 standing for the origin before the
+// first point. The segment between such points has no length, so its whole
+// branch of the fractal collapses to nothing.
+func (f *Fractal) CoincidentPoints() [][2]int {
+	var pairs [][2]int
+	prev := pixel.Vec{}
+	for i, p := range f.Base {
+		if p.Vec == prev {
+			pairs = append(pairs, [2]int{i - 1, i})
+		}
+		prev = p.Vec
+	}
+	return pairs
+}
+
+// finite reports whether both coordinates of v are ordinary numbers.
+func finite(v pixel.Vec) bool {
+	return !math.IsNaN(v.X) && !math.IsInf(v.X, 0) && !math.IsNaN(v.Y) && !math.IsInf(v.Y, 0)
+}
+
+// defaultRoot is where the depth 0 segment ends, unless it's been moved.
+var defaultRoot = Point{Vec: pixel.Vec{X: 1}}
+
+// rootBounds is the bounds of the depth 0 segment.
+func (f *Fractal) rootBounds() pixel.Rect {
+	return pixel.R(0, 0, f.Root.X, f.Root.Y).Norm()
+}
+
+// RootMatrix maps the base's coordinates onto the fractal's, which differ
+// if the root has been moved.
+func (f *Fractal) RootMatrix() pixel.Matrix {
+	return NewAffineBetween(Point{}, f.Root)
+}
+
+// RootChange rotates the root by the given angle, in radians, and scales
+// it by the given factor, which does the same to the whole fractal.
+func (f *Fractal) RootChange(angle, scale float64) {
+	f.pushUndo()
+	f.Root.Vec = f.Root.Vec.Rotated(angle).Scaled(scale)
+	root := f.Root
+	f.record(EditEvent{Op: opRoot, Root: &root})
+	f.Changed()
 }
 
 // BoundsAt allows us to compute partial bounds for a given tier.
 func (f *Fractal) BoundsAt(depth int) (r pixel.Rect) {
-	r.Min.X, r.Min.Y, r.Max.X, r.Max.Y = 0, 0, 1, 0
+	r = f.rootBounds()
 	for _, p := range f.lines[depth] {
 		if p.X < r.Min.X {
 			r.Min.X = p.X
@@ -126,11 +421,45 @@ func (f *Fractal) BoundsAt(depth int) (r pixel.Rect) {
 	return
 }
 
+// offscreenRecenter is how long the fractal can be out of view before the
+// view is reset to find it again.
+const offscreenRecenter = 2 * time.Second
+
+// onscreen reports whether rect, in fractal coordinates, overlaps port when
+// drawn with matrix. The view matrices only scale and move things, so the
+// corners are enough. A rect which projects to NaNs is never on screen.
+func onscreen(rect pixel.Rect, matrix pixel.Matrix, port pixel.Rect) bool {
+	projected := pixel.Rect{Min: matrix.Project(rect.Min), Max: matrix.Project(rect.Max)}.Norm()
+	if !finite(projected.Min) || !finite(projected.Max) {
+		return false
+	}
+	return projected.Max.X >= port.Min.X && projected.Min.X <= port.Max.X &&
+		projected.Max.Y >= port.Min.Y && projected.Min.Y <= port.Max.Y
+}
+
+// viewMatrix maps the fractal's rect onto the port, mirrored top to bottom
+// with FlipYOutput, and stretched by PixelAspect. Hit testing goes through
+// the same matrix, so it sees the points where they're drawn.
+func (f *Fractal) viewMatrix(rect, port pixel.Rect) pixel.Matrix {
+	m, _ := NewAffinesBetween(rect, port)
+	stretch := f.Settings.aspectScale()
+	if f.Settings.FlipYOutput {
+		stretch.Y = -stretch.Y
+	}
+	if stretch != (pixel.Vec{X: 1, Y: 1}) {
+		m = m.Chained(pixel.IM.ScaledXY(port.Center(), stretch))
+	}
+	return m
+}
+
 // AdjustedBounds produces the current bounds, adjusted to the aspect ratio
-// of r0, and scaled by a scale factor.
-func (f *Fractal) AdjustedBounds(r0 pixel.Rect, scale int32) (r pixel.Rect) {
+// of r0, scaled by a scale factor, and moved by pan.
+func (f *Fractal) AdjustedBounds(r0 pixel.Rect, scale float64, pan pixel.Vec) (r pixel.Rect) {
 	portRatio := r0.W() / r0.H()
 	r = f.Bounds
+	if f.inverseView != nil {
+		r = r.Union(f.inverseView.Bounds)
+	}
 	size := r.Size()
 	var dx, dy float64
 	if size.Y == 0 || (size.X/size.Y) > portRatio {
@@ -144,7 +473,7 @@ func (f *Fractal) AdjustedBounds(r0 pixel.Rect, scale int32) (r pixel.Rect) {
 	}
 	if scale != 0 {
 		dx, dy = r.Size().XY()
-		scaleFactor := math.Pow(0.95, float64(scale))
+		scaleFactor := math.Pow(0.95, scale)
 		dx *= scaleFactor - 1
 		dy *= scaleFactor - 1
 		r.Min.X -= dx / 2
@@ -152,7 +481,7 @@ func (f *Fractal) AdjustedBounds(r0 pixel.Rect, scale int32) (r pixel.Rect) {
 		r.Min.Y -= dy / 2
 		r.Max.Y += dy / 2
 	}
-	return
+	return r.Moved(pan)
 }
 
 // NewAffineBetween gives an affine transform that maps [0,0]->[1,0] onto the line segment between the given points.
@@ -180,10 +509,11 @@ func NewAffinesBetween(r0, r1 pixel.Rect) (to, from pixel.Matrix) {
 	return
 }
 
-// MaxOOMChange changes the Max Order of Magnitude, which controls MaxDepth
+// MaxOOMChange changes the Max Order of Magnitude, which controls MaxDepth,
+// within the range NewFractal allows.
 func (f *Fractal) MaxOOMChange(delta int) {
 	newMaxOOM := int(f.MaxOOM) + delta
-	if newMaxOOM < 4 || newMaxOOM > 30 {
+	if newMaxOOM < 0 || checkMaxOOM(uint(newMaxOOM)) != nil {
 		return
 	}
 	f.MaxOOM = uint(newMaxOOM)
@@ -194,7 +524,13 @@ func (f *Fractal) MaxOOMChange(delta int) {
 // Alloc reallocates the fractal's point/line storage, and should be needed
 // only when the number of points at each depth changes.
 func (f *Fractal) Alloc() {
+	mustHold("Alloc")
 	f.MaxDepth = 30
+	f.overflow = 0
+	// inserting or deleting points renumbers them
+	if len(f.Base) != f.mirrorLen {
+		f.mirror = nil
+	}
 	totals := make([]int, f.MaxDepth)
 	total := 0
 	npsize := 1 // total set of non-pruned points in current line
@@ -234,60 +570,172 @@ func (f *Fractal) Alloc() {
 		// cap maxdepth
 		if total+psize+npsize > (1 << f.MaxOOM) {
 			f.MaxDepth = i + 1
+			f.overflow = total + psize + npsize
 		}
 	}
 	f.Total = total
+	f.Totals = totals[:f.MaxDepth]
 	f.lines = make([][]Point, f.MaxDepth)
+	f.sizes = make([]float64, f.MaxDepth)
+	f.renderTimes = make([]time.Duration, f.MaxDepth)
 	prev := 0
-	fmt.Printf("%d points, %d depth, %d total size.\n", len(f.Base), f.MaxDepth, total)
+	if !f.quiet {
+		fmt.Printf("%d points, %d depth, %d total size.\n", len(f.Base), f.MaxDepth, total)
+	}
 	for i := 0; i < f.MaxDepth; i++ {
-		fmt.Printf("depth %d: %d to %d\n", i, prev, totals[i])
+		if !f.quiet {
+			fmt.Printf("depth %d: %d to %d\n", i, prev, totals[i])
+		}
 		f.lines[i] = f.data[prev:totals[i]]
 		prev = totals[i]
 	}
+	f.inverseView = nil
 	f.verbose = true
 	f.Changed()
 	f.verbose = false
 }
 
-// NewFractal allocates a fractal.
-func NewFractal(base []Point, maxOOM uint) *Fractal {
+// fillColorTab computes the color table, a full circle of hues. Normally
+// the hues are blended in the table's own (sRGB) values, which makes the
+// blends between primaries dim and muddy. With LinearColor, the blending
+// is done in linear light and then encoded, which gives brighter, cleaner
+// in-between colors, at the cost of the hues no longer being evenly spaced
+// to the eye; more of the table looks like the secondary colors. The table
+// is filled in place, since other fractals, like the onion skin, share it.
+func (f *Fractal) fillColorTab() {
+	for i := range f.colorTab {
+		h := int16((i * 360) / 1024)
+		s := int16(255)
+		v := int16(255)
+		r, g, b := rgb(h, s, v)
+		c := pixel.RGBA{R: float64(r) / 255, G: float64(g) / 255, B: float64(b) / 255, A: 1}
+		if f.Settings.LinearColor {
+			c.R, c.G, c.B = srgbEncode(c.R), srgbEncode(c.G), srgbEncode(c.B)
+		}
+		f.colorTab[i] = c
+	}
+	paletteGeneration++
+}
+
+// srgbEncode converts a linear light value to sRGB.
+func srgbEncode(x float64) float64 {
+	if x <= 0.0031308 {
+		return 12.92 * x
+	}
+	return 1.055*math.Pow(x, 1/2.4) - 0.055
+}
+
+// LinearColorChange toggles blending the color table in linear light.
+func (f *Fractal) LinearColorChange() {
+	f.Settings.LinearColor = !f.Settings.LinearColor
+	f.fillColorTab()
+}
+
+// MaxOOM is the log2 of the point budget, and all the points are allocated
+// up front. A Point is 32 bytes, so maxMaxOOM, 64M points, is 2GB; much
+// past that, a typo in a file or a flag would take the machine down. The
+// +MaxOOM button can still go further, a step at a time, on purpose.
+const (
+	minMaxOOM = 4
+	maxMaxOOM = 26
+)
+
+// MaxOOMForDepth yields the smallest MaxOOM which lets a base of baseLen
+// points render to the given depth: enough for every point of every depth
+// up to it, the same count Alloc makes, ignoring pruning, which only
+// makes for fewer points. Past maxMaxOOM, it just yields maxMaxOOM+1,
+// since that's already too many.
+func MaxOOMForDepth(baseLen, depth int) uint {
+	total, points := 0, 1
+	for i := 0; i <= depth; i++ {
+		total += points
+		points *= baseLen
+		if total > 1<<maxMaxOOM {
+			return maxMaxOOM + 1
+		}
+	}
+	oom := uint(0)
+	for 1<<oom < total {
+		oom++
+	}
+	return oom
+}
+
+// DepthChange sets MaxOOM to the smallest value that allows rendering the
+// given depth, within the usual limits, and reports if that's not enough.
+func (f *Fractal) DepthChange(depth int) {
+	oom := MaxOOMForDepth(len(f.Base), depth)
+	oom = uint(math.Max(minMaxOOM, math.Min(maxMaxOOM, float64(oom))))
+	f.MaxOOMChange(int(oom) - int(f.MaxOOM))
+	if f.MaxDepth <= depth {
+		fmt.Printf("depth %d needs more than the MaxOOM limit of %d; the deepest is %d\n", depth, maxMaxOOM, f.MaxDepth-1)
+	}
+}
+
+// NewFractal allocates a fractal. It's an error for maxOOM to be outside
+// the range from minMaxOOM to maxMaxOOM, and nothing is allocated.
+func NewFractal(base []Point, maxOOM uint) (*Fractal, error) {
+	return newFractal(base, maxOOM, false)
+}
+
+// newQuietFractal allocates a fractal the way NewFractal does, without
+// printing anything about it, for fractals which are only there to be
+// rendered or compared, rather than edited.
+func newQuietFractal(base []Point, maxOOM uint) (*Fractal, error) {
+	return newFractal(base, maxOOM, true)
+}
+
+func newFractal(base []Point, maxOOM uint, quiet bool) (*Fractal, error) {
+	if err := checkMaxOOM(maxOOM); err != nil {
+		return nil, err
+	}
 	f := new(Fractal)
+	f.quiet = quiet
 	f.Base = base[:]
 	f.selectedPoint = -1
 	f.MaxOOM = maxOOM
+	f.Settings = DefaultSettings()
+	f.Root = defaultRoot
 	f.data = make([]Point, 1<<f.MaxOOM, 1<<f.MaxOOM)
-	// special case: The first depth is automatic.
-	f.data[0] = Point{Vec: pixel.Vec{X: 1, Y: 0}}
 	// this will be capped by MaxOOM
 	f.Depth = 1
 	f.colorTab = make([]pixel.RGBA, 1024)
-	for i := range f.colorTab {
-		h := int16((i * 360) / 1024)
-		s := int16(255)
-		v := int16(255)
-		r, g, b := rgb(h, s, v)
-		f.colorTab[i] = pixel.RGBA{R: float64(r) / 255, G: float64(g) / 255, B: float64(b) / 255, A: 1}
-		// if i % 64 == 0 {
-		//	fmt.Printf("%d: %d, %d, %d => %d, %d, %d\n",
-		//		i, int(h), int(s), int(v), int(r), int(g), int(b))
-		//}
-	}
+	f.fillColorTab()
 	f.Alloc()
-	jsonstr, err := json.Marshal(*f)
-	if err == nil {
-		fmt.Printf("json: %s\n", jsonstr)
+	if !quiet {
+		jsonstr, err := json.Marshal(*f)
+		if err == nil {
+			fmt.Printf("json: %s\n", jsonstr)
+		}
+	}
+	return f, nil
+}
+
+// checkMaxOOM reports an error if maxOOM isn't a budget NewFractal allows.
+func checkMaxOOM(maxOOM uint) error {
+	if maxOOM < minMaxOOM || maxOOM > maxMaxOOM {
+		return fmt.Errorf("MaxOOM %d out of range %d to %d", maxOOM, minMaxOOM, maxMaxOOM)
 	}
-	return f
+	return nil
 }
 
 // Toggle toggles the selected flag bit
 func (f *Fractal) Toggle(flag int) {
-	if f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+	selected := f.selection()
+	if len(selected) == 0 {
 		return
 	}
-	f.Base[f.selectedPoint].Flags ^= flag
-	f.SelectPoint(f.selectedPoint)
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].Flags ^= flag
+		// a new gradient starts out solid
+		if flag == HasColor2 && f.Base[i].Flags&HasColor2 != 0 {
+			f.Base[i].Color2 = f.Base[i].Color
+		}
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opToggle, Points: selected, Amount: float64(flag)})
+	f.showSelected()
 	if flag == Prune {
 		f.Alloc()
 	} else {
@@ -295,51 +743,241 @@ func (f *Fractal) Toggle(flag int) {
 	}
 }
 
+// InverseModeChange cycles through the inverse modes.
+func (f *Fractal) InverseModeChange() {
+	f.pushUndo()
+	f.InverseMode = (f.InverseMode + 1) % inverseModes
+	f.Changed()
+}
+
+// FlagModeChange cycles through the flag modes.
+func (f *Fractal) FlagModeChange() {
+	f.pushUndo()
+	f.FlagMode = (f.FlagMode + 1) % flagModes
+	f.Changed()
+}
+
+// ColorModeChange cycles through the color modes.
+func (f *Fractal) ColorModeChange() {
+	f.pushUndo()
+	f.ColorMode = (f.ColorMode + 1) % colorModes
+	f.Changed()
+}
+
+// WrapModeChange cycles through the wrap modes.
+func (f *Fractal) WrapModeChange() {
+	f.pushUndo()
+	f.WrapMode = (f.WrapMode + 1) % wrapModes
+	f.Changed()
+}
+
+// wrapColor brings an accumulated color back into the color table, the
+// way WrapMode says to. It takes an int, since a weighted color can be past
+// what an int16 holds before it's wrapped.
+func (f *Fractal) wrapColor(c int) int16 {
+	switch f.WrapMode {
+	case WrapClamp:
+		if c < 0 {
+			return 0
+		}
+		if c > 1023 {
+			return 1023
+		}
+		return int16(c)
+	case WrapPingPong:
+		// there and back is 2046 steps, not 2048, since the ends
+		// aren't repeated
+		c = ((c % 2046) + 2046) % 2046
+		if c > 1023 {
+			c = 2046 - c
+		}
+		return int16(c)
+	}
+	return int16(((c % 1024) + 1024) % 1024)
+}
+
+// GlobalFixedColorChange cycles through the global fixed color modes.
+func (f *Fractal) GlobalFixedColorChange() {
+	f.pushUndo()
+	f.GlobalFixedColor = (f.GlobalFixedColor + 1) % globalFixedModes
+	f.Changed()
+}
+
+// fixedColor reports whether p's color is treated as fixed, going by its
+// FixedC flag unless GlobalFixedColor overrides it.
+func (f *Fractal) fixedColor(p Point) bool {
+	switch f.GlobalFixedColor {
+	case FixedAll:
+		return true
+	case FixedNone:
+		return false
+	}
+	return p.Flags&FixedC != 0
+}
+
+// AnchorColors yields the colors the base points get in ColorAnchorInterp
+// mode. FixedC points, as fixedColor sees them, are anchors, and keep
+// their own colors. Other points get colors interpolated, by position in
+// the base, between the nearest anchors before and after them, going the
+// short way around the color table. Points before the first anchor or
+// after the last just get that anchor's color. With no anchors at all,
+// every point keeps its own color.
+func (f *Fractal) AnchorColors() []int16 {
+	colors := make([]int16, len(f.Base))
+	prev := -1
+	for i, p := range f.Base {
+		colors[i] = modPlus(p.Color, 1024)
+		if !f.fixedColor(p) {
+			continue
+		}
+		for j := prev + 1; j < i; j++ {
+			if prev < 0 {
+				colors[j] = colors[i]
+				continue
+			}
+			// the short way around, from -512 to +511
+			delta := modPlus(colors[i]-colors[prev]+512, 1024) - 512
+			t := float64(j-prev) / float64(i-prev)
+			colors[j] = modPlus(colors[prev]+int16(math.Round(float64(delta)*t)), 1024)
+		}
+		prev = i
+	}
+	if prev >= 0 {
+		for j := prev + 1; j < len(colors); j++ {
+			colors[j] = colors[prev]
+		}
+	}
+	return colors
+}
+
+// DepthColor maps a depth onto the color table, for ColorByDepth. Depth 1
+// gets the first color and the deepest possible depth gets the last. With
+// a linear mapping, the colors are evenly spaced; with a logarithmic one,
+// the shallow depths, which usually look the most different, are spread
+// out more.
+func (f *Fractal) DepthColor(depth int, logarithmic bool) int16 {
+	deepest := f.MaxDepth - 1
+	if deepest <= 1 || depth <= 1 {
+		return 0
+	}
+	var t float64
+	if logarithmic {
+		t = math.Log(float64(depth)) / math.Log(float64(deepest))
+	} else {
+		t = float64(depth-1) / float64(deepest-1)
+	}
+	return int16(math.Round(math.Min(t, 1) * 1023))
+}
+
 // ColorChange adds an amount to the color trait of the point.
 func (f *Fractal) ColorChange(amt int) {
-	if f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+	selected := f.selection()
+	if len(selected) == 0 {
+		return
+	}
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].Color += int16(amt)
+		f.Base[i].Color %= 1024
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opColor, Points: selected, Amount: float64(amt)})
+	f.showSelected()
+	f.Changed()
+}
+
+// Color2Change adds an amount to the end color of the selected point(s),
+// which only matters for those with HasColor2.
+func (f *Fractal) Color2Change(amt int) {
+	selected := f.selection()
+	if len(selected) == 0 {
+		return
+	}
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].Color2 = modPlus(f.Base[i].Color2+int16(amt), 1024)
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opColor2, Points: selected, Amount: float64(amt)})
+	f.showSelected()
+	f.Changed()
+}
+
+// SetColorAbsolute sets the color of the selected point(s). Colors outside
+// the color table wrap around, as they would when rendered.
+func (f *Fractal) SetColorAbsolute(c int16) {
+	selected := f.selection()
+	if len(selected) == 0 {
 		return
 	}
-	f.Base[f.selectedPoint].Color += int16(amt)
-	f.Base[f.selectedPoint].Color %= 1024
-	f.SelectPoint(f.selectedPoint)
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].Color = modPlus(c, 1024)
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opSetColor, Points: selected, Amount: float64(c)})
+	f.showSelected()
 	f.Changed()
 }
 
 // XChange adds an amount to the X location of the point.
 func (f *Fractal) XChange(amt float64) {
-	if f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+	selected := f.selection()
+	if len(selected) == 0 {
 		return
 	}
-	f.Base[f.selectedPoint].X += amt
-	f.SelectPoint(f.selectedPoint)
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].X += amt
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opX, Points: selected, Amount: amt})
+	f.showSelected()
 	f.Changed()
 }
 
 // YChange adds an amount to the Y location of the point.
 func (f *Fractal) YChange(amt float64) {
-	if f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+	selected := f.selection()
+	if len(selected) == 0 {
 		return
 	}
-	f.Base[f.selectedPoint].Y += amt
-	f.SelectPoint(f.selectedPoint)
+	f.pushUndo()
+	for _, i := range selected {
+		f.Base[i].Y += amt
+	}
+	f.mirrorFrom(selected)
+	f.record(EditEvent{Op: opY, Points: selected, Amount: amt})
+	f.showSelected()
 	f.Changed()
 }
 
 // AddPoint divides the line segment ending in the currently selected point in half.
 func (f *Fractal) AddPoint() {
+	f.AddPointAt(0.5)
+}
+
+// AddPointAt divides the line segment ending in the currently selected point,
+// putting the new point t of the way along it, for 0 < t < 1. The new point
+// gets the selected point's flags and color.
+func (f *Fractal) AddPointAt(t float64) {
 	// cap size
-	if len(f.Base) >= 6 || f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+	if len(f.Base) >= MaxBasePoints || f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+		return
+	}
+	if !(t > 0 && t < 1) {
 		return
 	}
+	f.pushUndo()
+	f.record(EditEvent{Op: opAdd, Points: []int{f.selectedPoint}, Amount: t})
 	newbase := make([]Point, len(f.Base)+1)
 	j := 0
 	prev := Point{}
 	for i, p := range f.Base {
 		if i == f.selectedPoint {
 			newPoint := p
-			newPoint.X = (p.X + prev.X) / 2
-			newPoint.Y = (p.Y + prev.Y) / 2
+			newPoint.X = prev.X + (p.X-prev.X)*t
+			newPoint.Y = prev.Y + (p.Y-prev.Y)*t
 			newbase[j] = newPoint
 			// fmt.Printf("New point[%d]: %.3f, %.3f\n", j, p.X, p.Y)
 			j++
@@ -352,12 +990,45 @@ func (f *Fractal) AddPoint() {
 	f.Alloc()
 }
 
+// SubdivideAll divides every segment of the base in half, the way AddPoint
+// does for one; each new point gets the flags and color of the point ending
+// its segment. It's all or nothing: if twice as many points wouldn't fit in
+// MaxBasePoints, it leaves the base alone, rather than subdividing some
+// segments and not others.
+func (f *Fractal) SubdivideAll() {
+	if len(f.Base)*2 > MaxBasePoints {
+		fmt.Printf("subdivide: %d points would exceed the maximum of %d\n", len(f.Base)*2, MaxBasePoints)
+		return
+	}
+	f.pushUndo()
+	f.record(EditEvent{Op: opSubdivide})
+	newbase := make([]Point, 0, len(f.Base)*2)
+	prev := Point{}
+	for _, p := range f.Base {
+		mid := p
+		mid.Vec = pixel.Lerp(prev.Vec, p.Vec, 0.5)
+		newbase = append(newbase, mid, p)
+		prev = p
+	}
+	f.Base = newbase
+	// the old points are now at odd indices
+	if f.selectedPoint >= 0 {
+		f.selectedPoint = f.selectedPoint*2 + 1
+	}
+	for i := range f.multiSelect {
+		f.multiSelect[i] = f.multiSelect[i]*2 + 1
+	}
+	f.Alloc()
+}
+
 // DelPoint deletes the currently selected point.
 func (f *Fractal) DelPoint() {
 	// cap size
 	if len(f.Base) < 3 || f.selectedPoint < 0 || f.selectedPoint > len(f.Base) {
 		return
 	}
+	f.pushUndo()
+	f.record(EditEvent{Op: opDel, Points: []int{f.selectedPoint}})
 	newbase := make([]Point, len(f.Base)-1)
 	j := 0
 	for i, p := range f.Base {
@@ -370,44 +1041,269 @@ func (f *Fractal) DelPoint() {
 	f.Alloc()
 }
 
-// Points returns the points for a given depth. This is trivial except for
-// the hackery to make depth 0 work. It's probably wrong.
+// cloneOffset is how far ClonePoint moves the clone, in fractal units, so
+// the two points can be told apart.
+var cloneOffset = pixel.Vec{X: -0.02, Y: 0.02}
+
+// ClonePoint inserts a copy of the currently selected point, with the same
+// flags and color, just before it, and selects the copy. The clone goes
+// before the original so that cloning the last point doesn't move the end
+// of the curve.
+func (f *Fractal) ClonePoint() {
+	if len(f.Base) >= MaxBasePoints || f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+		return
+	}
+	f.pushUndo()
+	idx := f.selectedPoint
+	f.record(EditEvent{Op: opClone, Points: []int{idx}})
+	clone := f.Base[idx]
+	clone.Vec = clone.Vec.Add(cloneOffset)
+	newbase := make([]Point, 0, len(f.Base)+1)
+	newbase = append(newbase, f.Base[:idx]...)
+	newbase = append(newbase, clone)
+	newbase = append(newbase, f.Base[idx:]...)
+	f.Base = newbase
+	f.SelectPoint(idx)
+	f.Alloc()
+}
+
+// MergePoint merges the currently selected point with the one before it,
+// into a single point at their midpoint, which keeps the selected point's
+// color and flags. If the selected point is the last one, the merged point
+// stays where it is, since the last point is the end of the curve. The
+// first point can't be merged, since the point before it is the origin.
+func (f *Fractal) MergePoint() {
+	if len(f.Base) < 3 || f.selectedPoint < 1 || f.selectedPoint >= len(f.Base) {
+		return
+	}
+	f.pushUndo()
+	idx := f.selectedPoint
+	f.record(EditEvent{Op: opMerge, Points: []int{idx}})
+	merged := f.Base[idx]
+	if idx != len(f.Base)-1 {
+		merged.Vec = f.Base[idx-1].Vec.Add(merged.Vec).Scaled(0.5)
+	}
+	newbase := make([]Point, 0, len(f.Base)-1)
+	newbase = append(newbase, f.Base[:idx-1]...)
+	newbase = append(newbase, merged)
+	newbase = append(newbase, f.Base[idx+1:]...)
+	f.Base = newbase
+	f.SelectPoint(idx - 1)
+	f.Alloc()
+}
+
+// FlattenToBase makes the curve at the given depth the new base, so
+// recursion starts from that generation instead. Colors and flags are kept
+// as they were rendered. Rendered positions have the root transform
+// applied, so they're mapped back through it; since every depth's curve
+// runs from the implicit {0,0} to the root, the new base ends at {1,0},
+// like any other. This fails if the result would exceed MaxBasePoints.
+func (f *Fractal) FlattenToBase(depth int) error {
+	if depth < 1 || depth > f.Depth {
+		return fmt.Errorf("flatten: depth %d hasn't been rendered", depth)
+	}
+	points := f.Points(depth)
+	if len(points) > MaxBasePoints {
+		return fmt.Errorf("flatten: depth %d has %d points, max is %d", depth, len(points), MaxBasePoints)
+	}
+	f.pushUndo()
+	root := f.RootMatrix()
+	base := make([]Point, len(points))
+	for i, p := range points {
+		p.Vec = root.Unproject(p.Vec)
+		base[i] = p
+	}
+	// exactly, despite rounding
+	base[len(base)-1].Vec = pixel.Vec{X: 1}
+	f.setBase(base)
+	f.recordBase()
+	f.SelectPoint(-1)
+	f.Alloc()
+	return nil
+}
+
+// FlattenDepth yields the deepest rendered depth past 1 which FlattenToBase
+// can make the new base without exceeding MaxBasePoints. If there isn't
+// one, it yields 2, so FlattenToBase can say why not.
+func (f *Fractal) FlattenDepth() int {
+	depth := 2
+	for d := 2; d <= f.Depth; d++ {
+		if len(f.Points(d)) > MaxBasePoints {
+			break
+		}
+		depth = d
+	}
+	return depth
+}
+
+// StashReference keeps a copy of the current base as the reference, for
+// SwapReference to compare it with. While the reference is swapped in, the
+// working base is where the reference would go, so it has to be swapped
+// back first.
+func (f *Fractal) StashReference() {
+	if f.referenceOn {
+		fmt.Printf("reference: swap back to the working base before stashing\n")
+		return
+	}
+	f.reference = make([]Point, len(f.Base))
+	copy(f.reference, f.Base)
+}
+
+// SwapReference swaps the base with the stashed reference, so that
+// swapping again gets back to where it started. Each swap can be undone.
+func (f *Fractal) SwapReference() {
+	if f.reference == nil {
+		fmt.Printf("reference: nothing stashed yet\n")
+		return
+	}
+	f.pushUndo()
+	f.undo[len(f.undo)-1].swapped = true
+	base := f.Base
+	f.setBase(f.reference)
+	f.reference = base
+	f.referenceOn = !f.referenceOn
+	f.recordBase()
+	if f.selectedPoint >= len(f.Base) {
+		f.SelectPoint(-1)
+	} else {
+		f.SelectPoint(f.selectedPoint)
+	}
+	f.Alloc()
+}
+
+// maxUndo is the number of previous bases kept for Undo.
+const maxUndo = 100
+
+// onionOOM is the point budget for onion skins; they only get the shallow
+// depths Changed renders, so it doesn't need to be large.
+const onionOOM = 12
+
+// onionFade is how bright the onion skin is, compared to the live fractal.
+const onionFade = 0.3
+
+// onionSkin returns a copy of the fractal, rendered to a shallow depth,
+// to draw as a ghost while it's being edited.
+func (f *Fractal) onionSkin() *Fractal {
+	base := make([]Point, len(f.Base))
+	copy(base, f.Base)
+	// onionOOM is in range, so this can't fail
+	ghost, _ := newQuietFractal(base, onionOOM)
+	ghost.useSaved(f)
+	ghost.Base = base
+	ghost.Settings.ShowInverse = false
+	ghost.colorTab = f.colorTab
+	ghost.Changed()
+	return ghost
+}
+
+// undoEntry is a base Undo can get back to, along with the root and the
+// modes that change how it's rendered. swapped means the change was
+// SwapReference, so the reference has to be swapped back too, and
+// referenceOn is whether the reference was swapped in.
+type undoEntry struct {
+	base        []Point
+	root        Point
+	inverseMode int
+	flagMode    int
+	colorMode   int
+	wrapMode    int
+	globalFixed int
+	swapped     bool
+	referenceOn bool
+}
+
+// pushUndo records the current base, root, and modes so Undo can get back
+// to them. Call it before changing any of them.
+func (f *Fractal) pushUndo() {
+	f.snapshotChanges()
+	saved := make([]Point, len(f.Base))
+	copy(saved, f.Base)
+	if len(f.undo) >= maxUndo {
+		f.undo = append(f.undo[:0], f.undo[1:]...)
+	}
+	f.undo = append(f.undo, undoEntry{
+		base:        saved,
+		root:        f.Root,
+		inverseMode: f.InverseMode,
+		flagMode:    f.FlagMode,
+		colorMode:   f.ColorMode,
+		wrapMode:    f.WrapMode,
+		globalFixed: f.GlobalFixedColor,
+		referenceOn: f.referenceOn,
+	})
+}
+
+// Undo restores the base, root, and modes as they were before the most
+// recent change.
+func (f *Fractal) Undo() {
+	if len(f.undo) == 0 {
+		return
+	}
+	entry := f.undo[len(f.undo)-1]
+	if entry.swapped {
+		f.reference = f.Base
+	}
+	f.referenceOn = entry.referenceOn
+	f.setBase(entry.base)
+	f.Root = entry.root
+	f.InverseMode, f.FlagMode, f.ColorMode = entry.inverseMode, entry.flagMode, entry.colorMode
+	f.WrapMode, f.GlobalFixedColor = entry.wrapMode, entry.globalFixed
+	f.undo = f.undo[:len(f.undo)-1]
+	f.record(EditEvent{Op: opUndo})
+	if f.selectedPoint >= len(f.Base) {
+		f.SelectPoint(-1)
+	} else {
+		f.SelectPoint(f.selectedPoint)
+	}
+	f.Alloc()
+}
+
+// Points returns the points for a given depth.
 func (f *Fractal) Points(depth int) []Point {
 	if depth > f.Depth || depth < 0 {
 		return nil
 	}
-	if depth == 0 {
-		return []Point{Point{Vec: pixel.Vec{X: 1, Y: 0}}}
-	}
 	return f.lines[depth]
 }
 
 // Render computes the points for a given depth, if the previous line is filled in.
 func (f *Fractal) Render(depth int) bool {
+	mustHold("Render")
 	var src []Point
-	// the 0-depth case is already filled in, but we need to fix color for it
+	// depth 0 is just the segment from the origin to the root. It's filled
+	// in here, rather than once, because reallocating the storage loses it.
 	if depth == 0 {
+		f.lines[0][0] = f.Root
 		return true
 	}
+	if f.nonFinite {
+		f.renderErr = fmt.Errorf("base point %d isn't finite", f.NonFinite()+1)
+		return false
+	}
+	started := time.Now()
 	if depth == 1 {
 		dest := f.lines[depth]
 		for i := range f.Base {
-			dest[i] = f.Base[i]
-			if dest[i].Flags&FixedC != 0 {
-				dest[i].Color = modPlus(dest[i].Color, 1024)
-			} else {
-				dest[i].Color = 0
-			}
+			dest[i] = f.depthOnePoint(i)
 		}
+		// the base can reach well outside the unit segment, so depth 1
+		// counts towards the bounds like any other
+		nb := f.BoundsAt(depth)
+		f.Bounds = f.Bounds.Union(nb)
+		f.sizes[depth] = nb.Size().Len()
+		f.renderTimes[depth] = time.Since(started)
 		if f.Depth < 1 {
 			f.Depth = 1
 		}
+		f.logRender(depth)
+		f.generation++
 		return true
 	}
 	if depth > 0 && depth < f.MaxDepth {
 		src = f.Points(depth - 1)
 	}
 	if src == nil {
+		f.renderErr = fmt.Errorf("depth %d isn't rendered, or %d is past MaxDepth", depth-1, depth)
 		return false
 	}
 	dest := f.lines[depth]
@@ -424,10 +1320,10 @@ func (f *Fractal) Render(depth int) bool {
 		// fmt.Printf("rendering partial %d [%d:%d]\n", p, offset, offset + l)
 		if src[i].Flags&Prune == 0 {
 			if debuggingPrunes != 0 {
-				p, np := f.Partial(prev, src[i], dest[offset:offset+l])
+				p, np := f.Partial(depth, prev, src[i], dest[offset:offset+l])
 				pruned, npruned = pruned+p, npruned+np
 			} else {
-				f.Partial(prev, src[i], dest[offset:offset+l])
+				f.Partial(depth, prev, src[i], dest[offset:offset+l])
 			}
 			offset += l
 		} else {
@@ -444,20 +1340,121 @@ func (f *Fractal) Render(depth int) bool {
 	}
 	nb := f.BoundsAt(depth)
 	f.Bounds = f.Bounds.Union(nb)
+	f.sizes[depth] = nb.Size().Len()
+	f.renderTimes[depth] = time.Since(started)
+	if v := f.inverseView; v != nil && depth > v.Depth {
+		v.Render(depth)
+	}
 
 	if f.Depth < depth {
 		f.Depth = depth
 	}
+	f.logRender(depth)
+	f.generation++
 	return true
 }
 
-// Partial computes the points interpolated from a single point pair.
-func (f *Fractal) Partial(p0 Point, p1 Point, dest []Point) (int, int) {
-	flipY := p1.Flags&FlipY != 0
-	flipX := p1.Flags&FlipX != 0
-	a := NewAffineBetween(p0, p1)
-	var base []Point
-	if flipX {
+// logRender records how long depth took to render in renderTimings,
+// unless the fractal is a quiet one nobody's editing.
+func (f *Fractal) logRender(depth int) {
+	if !f.quiet {
+		renderTimings.Record(depth, len(f.Points(depth)), f.renderTimes[depth])
+	}
+}
+
+// divergenceRatio is how much each depth's bounds can grow over the
+// previous depth's before the fractal is considered to be diverging.
+// Fractals which stay bounded grow less and less with each depth.
+const divergenceRatio = 1.2
+
+// Diverging reports whether the fractal appears to grow without bound,
+// which is to say, the last couple of depths rendered each got
+// substantially bigger than the one before.
+func (f *Fractal) Diverging() bool {
+	if f.Depth < 4 {
+		return false
+	}
+	for d := f.Depth - 1; d <= f.Depth; d++ {
+		if f.sizes[d] <= f.sizes[d-1]*divergenceRatio {
+			return false
+		}
+	}
+	return true
+}
+
+// depthOnePoint computes the depth 1 point corresponding to a base point,
+// which differs from it only in color.
+func (f *Fractal) depthOnePoint(i int) Point {
+	p := f.Base[i]
+	p.Vec = f.RootMatrix().Project(p.Vec)
+	color := p.Color
+	if f.ColorMode == ColorAnchorInterp {
+		p.Color = f.anchorColors[i]
+	} else if f.ColorMode == ColorPinned || f.fixedColor(p) {
+		p.Color = modPlus(p.Color, 1024)
+	} else {
+		p.Color = 0
+	}
+	p.Color2 = modPlus(p.Color2+p.Color-color, 1024)
+	return p
+}
+
+// RenderStream computes the points for a given depth one at a time, passing
+// each to emit in order, without storing the intermediate depths. Render
+// needs room for every point of every depth, which limits how deep it can
+// go; this needs only one base's worth of points per depth, so it can go as
+// deep as you have time for. The points are the same ones Render would
+// produce.
+func (f *Fractal) RenderStream(depth int, emit func(Point)) {
+	if f.nonFinite {
+		return
+	}
+	if depth < 1 {
+		emit(f.Root)
+		return
+	}
+	// last[d] is the most recent point generated at depth d, which
+	// is the start of the segment ending at the next one.
+	last := make([]Point, depth+1)
+	scratch := make([][]Point, depth+1)
+	for d := range scratch {
+		scratch[d] = make([]Point, len(f.Base))
+	}
+	var visit func(d int, p Point)
+	visit = func(d int, p Point) {
+		prev := last[d]
+		last[d] = p
+		if d == depth {
+			emit(p)
+			return
+		}
+		if p.Flags&Prune != 0 {
+			visit(d+1, p)
+			return
+		}
+		children := scratch[d+1]
+		f.Partial(d+1, prev, p, children)
+		for _, c := range children {
+			visit(d+1, c)
+		}
+	}
+	for i := range f.Base {
+		visit(1, f.depthOnePoint(i))
+	}
+}
+
+// Partial computes the points interpolated from a single point pair, which
+// go in the given depth.
+func (f *Fractal) Partial(depth int, p0 Point, p1 Point, dest []Point) (int, int) {
+	flipY := p1.Flags&FlipY != 0
+	flipX := p1.Flags&FlipX != 0
+	a := NewAffineBetween(p0, p1)
+	color := int(p1.Color)
+	if f.ColorDepthWeight != nil {
+		color = int(math.Round(float64(color) * f.ColorDepthWeight(depth)))
+	}
+	var base []Point
+	if flipX {
 		base = f.Inverse
 	} else {
 		base = f.Base
@@ -477,16 +1474,148 @@ func (f *Fractal) Partial(p0 Point, p1 Point, dest []Point) (int, int) {
 			pruned++
 		}
 		dest[i].Vec = a.Project(p.Vec)
-		if p.Flags&FixedC == 0 {
-			dest[i].Color += p1.Color
+		c := int(p.Color)
+		if f.ColorMode == ColorPinned {
+			c = int(p1.Color)
+		} else if f.ColorMode == ColorAnchorInterp {
+			// the inverse base has the values in reverse order
+			if flipX {
+				c = int(f.anchorColors[len(base)-1-i])
+			} else {
+				c = int(f.anchorColors[i])
+			}
+		} else if freeze := f.Settings.ColorFreezeDepth; freeze >= 0 && depth > freeze {
+			// past the freeze depth, points keep their ancestor's color
+			c = int(p1.Color)
+		} else if !f.fixedColor(p) {
+			c += color
+		}
+		dest[i].Color = f.wrapColor(c)
+		// the end color moves with the color, so gradients keep their shape
+		dest[i].Color2 = f.wrapColor(int(p.Color2) + int(dest[i].Color) - int(p.Color))
+		if f.FlagMode == FlagsOr {
+			dest[i].Flags |= (p1.Flags & (FlipX | FlipY))
+		} else {
+			dest[i].Flags ^= (p1.Flags & (FlipX | FlipY))
 		}
-		dest[i].Color = modPlus(dest[i].Color, 1024)
-		dest[i].Flags ^= (p1.Flags & (FlipX | FlipY))
+		// a dashed segment's whole subtree is dashed
+		dest[i].Flags |= p1.Flags & Dashed
 		// fmt.Printf("... point %d: %v\n", i, dest[i])
 	}
 	return npruned, pruned
 }
 
+// Snap finds the snap target nearest to v, if there's one within the
+// snap radius, measured in canvas pixels under matrix. The targets are
+// the ends of the unit segment, and, if the settings say so, the base
+// points other than skip, which is the one being dragged.
+func (f *Fractal) Snap(v pixel.Vec, matrix pixel.Matrix, skip int) (pixel.Vec, bool) {
+	var targets []pixel.Vec
+	if f.Settings.SnapEndpoints {
+		targets = append(targets, pixel.Vec{}, pixel.Vec{X: 1})
+	}
+	if f.Settings.SnapPoints {
+		for i, p := range f.Base {
+			if i != skip {
+				targets = append(targets, p.Vec)
+			}
+		}
+	}
+	canV := matrix.Project(v)
+	best, found := v, false
+	leastDist := f.Settings.SnapRadius
+	for _, t := range targets {
+		dist := matrix.Project(t).Sub(canV).Len()
+		if dist <= leastDist {
+			best, found, leastDist = t, true, dist
+		}
+	}
+	return best, found
+}
+
+// clampVec yields the point in r nearest to v.
+func clampVec(v pixel.Vec, r pixel.Rect) pixel.Vec {
+	return pixel.Vec{
+		X: math.Max(r.Min.X, math.Min(r.Max.X, v.X)),
+		Y: math.Max(r.Min.Y, math.Min(r.Max.Y, v.Y)),
+	}
+}
+
+// pickRadius is how close, in window pixels, a click has to be to a base
+// point to pick it. Past that, out to pickFallback times as far, a click
+// still picks the nearest point if it's unambiguous, meaning the next
+// nearest is at least pickMargin times as far away.
+const (
+	pickRadius   = 15.0
+	pickFallback = 4.0
+	pickMargin   = 2.0
+)
+
+// HitPoint finds the base point nearest to canPos, which is in canvas
+// coordinates, or -1 if there isn't one close enough; matrix maps base
+// coordinates onto the canvas, and radius is pickRadius in canvas pixels.
+// The distances are measured on the canvas, so the area a click covers
+// stays the same on screen however far the view is zoomed; the fallback
+// is so points stay selectable when zoomed in until they're far apart.
+func (f *Fractal) HitPoint(canPos pixel.Vec, matrix pixel.Matrix, radius float64) int {
+	nearest, second := -1, -1
+	var nearestDist, secondDist float64
+	for i, p := range f.Base {
+		dist := matrix.Project(p.Vec).Sub(canPos).Len()
+		switch {
+		case nearest < 0 || dist < nearestDist:
+			second, secondDist = nearest, nearestDist
+			nearest, nearestDist = i, dist
+		case second < 0 || dist < secondDist:
+			second, secondDist = i, dist
+		}
+	}
+	switch {
+	case nearest < 0:
+		return -1
+	case nearestDist < radius:
+		return nearest
+	case nearestDist < radius*pickFallback && (second < 0 || secondDist >= nearestDist*pickMargin):
+		return nearest
+	}
+	return -1
+}
+
+// HitSegment finds the drawn segment at the given depth nearest to canPos,
+// which is in canvas coordinates; matrix maps fractal coordinates onto the
+// canvas. The returned index is into Points(depth), and names the point
+// which ends the segment. Hidden segments can't be hit.
+func (f *Fractal) HitSegment(canPos pixel.Vec, matrix pixel.Matrix, depth int) (segmentIndex int, ok bool) {
+	points := f.Points(depth)
+	leastDist := 30.0
+	segmentIndex = -1
+	prev := matrix.Project(pixel.Vec{})
+	for i, p := range points {
+		pv := matrix.Project(p.Vec)
+		if p.Flags&Hide == 0 {
+			dist := segmentDistance(canPos, prev, pv)
+			if dist < leastDist {
+				leastDist = dist
+				segmentIndex = i
+			}
+		}
+		prev = pv
+	}
+	return segmentIndex, segmentIndex >= 0
+}
+
+// segmentDistance yields the distance from p to the line segment from a to b.
+func segmentDistance(p, a, b pixel.Vec) float64 {
+	ab := b.Sub(a)
+	l2 := ab.X*ab.X + ab.Y*ab.Y
+	if l2 == 0 {
+		return p.Sub(a).Len()
+	}
+	t := ((p.X-a.X)*ab.X + (p.Y-a.Y)*ab.Y) / l2
+	t = math.Max(0, math.Min(1, t))
+	return p.Sub(a.Add(ab.Scaled(t))).Len()
+}
+
 func loadTTF(path string, size float64) (font.Face, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -510,8 +1639,6 @@ func loadTTF(path string, size float64) (font.Face, error) {
 	}), nil
 }
 
-var runningMutex sync.Mutex
-
 // modPlus yields the positive remainder of x/y
 func modPlus(x, y int16) int16 {
 	x = x % y
@@ -576,14 +1703,211 @@ func (p *Point) UIFlag(label string, flag int) {
 
 // SelectPoint marks a given point as the current selected point, populating UI fields.
 func (f *Fractal) SelectPoint(index int) {
+	f.multiSelect = nil
+	f.selectedPoint = index
+	f.showSelected()
+}
+
+// MirrorChange pairs the two selected points, so that edits to either are
+// mirrored to the other across X=0.5, the middle of the unit segment; the
+// second is moved to match the first, and the segment reflecting the
+// first's gets its colors and flags; see mirrorFrom. With one point selected, it clears
+// that point's pairing. Pairs only last until points are added or deleted,
+// or the base is replaced.
+func (f *Fractal) MirrorChange() {
+	selected := f.selection()
+	if len(selected) == 2 && selected[0] == selected[1] {
+		fmt.Printf("mirror: a point can't be paired with itself\n")
+		return
+	}
+	if len(selected) == 1 || len(selected) == 2 {
+		f.record(EditEvent{Op: opMirror, Points: selected})
+	}
+	switch len(selected) {
+	case 1:
+		if j, ok := f.mirror[selected[0]]; ok {
+			delete(f.mirror, selected[0])
+			delete(f.mirror, j)
+		}
+	case 2:
+		a, b := selected[0], selected[1]
+		if f.mirror == nil || f.mirrorLen != len(f.Base) {
+			f.mirror = map[int]int{}
+			f.mirrorLen = len(f.Base)
+		}
+		// a point can only have one partner
+		for _, i := range selected {
+			if j, ok := f.mirror[i]; ok {
+				delete(f.mirror, j)
+			}
+		}
+		f.mirror[a], f.mirror[b] = b, a
+		f.pushUndo()
+		f.mirrorFrom([]int{a})
+		f.Changed()
+	default:
+		fmt.Printf("mirror: select two points to pair, or one to unpair\n")
+	}
+}
+
+// MirrorBase replaces the points after the axis point with a mirror image
+// of the ones before it, reflected across the vertical line through it, so
+// only half of a symmetric base has to be made by hand. The curve goes back
+// through the reflections in reverse order, ending at the reflection of the
+// origin, which is {1, 0} when the axis is at X=0.5; otherwise, the new
+// base is scaled so that it ends there, which keeps it symmetric around
+// X=0.5. The axis has to be to the right of the origin. Each reflected segment
+// runs the other way, so it gets the color and flags of the segment it
+// mirrors, with gradients reversed and FlipX toggled; in the ReflectX
+// inverse mode, that makes the whole fractal symmetric, not just the base.
+func (f *Fractal) MirrorBase(axis int) error {
+	if axis < 0 || axis >= len(f.Base) {
+		return errors.New("mirror base: select the point to mirror around")
+	}
+	n := 2*axis + 2
+	if n > MaxBasePoints {
+		return fmt.Errorf("mirror base: %d points would exceed the maximum of %d", n, MaxBasePoints)
+	}
+	ax := f.Base[axis].X
+	if !(ax > 0) {
+		return errors.New("mirror base: the point to mirror around has to be right of the origin")
+	}
+	f.pushUndo()
+	newbase := make([]Point, 0, n)
+	newbase = append(newbase, f.Base[:axis+1]...)
+	for j := axis - 1; j >= -1; j-- {
+		// the segment ending at the reflection of point j mirrors the
+		// one from point j to j+1, which ends at j+1
+		p := mirrorSegment(f.Base[j+1])
+		at := pixel.Vec{}
+		if j >= 0 {
+			at = f.Base[j].Vec
+		}
+		p.Vec = pixel.Vec{X: 2*ax - at.X, Y: at.Y}
+		newbase = append(newbase, p)
+	}
+	if end := 2 * ax; end != 1 {
+		fit := NewAffineBetween(Point{}, Point{Vec: pixel.Vec{X: end}})
+		for i := range newbase {
+			newbase[i].Vec = fit.Unproject(newbase[i].Vec)
+		}
+	}
+	f.setBase(newbase)
+	f.recordBase()
+	f.SelectPoint(axis)
+	f.Alloc()
+	return nil
+}
+
+// setBase replaces the whole base. Mirror pairs are indices into the old
+// base, which needn't mean anything in the new one, so they're dropped.
+func (f *Fractal) setBase(base []Point) {
+	f.Base = base
+	f.mirror = nil
+}
+
+// mirrorFrom moves the partners of the edited points, if they have them,
+// to their reflections across X=0.5. Colors and flags belong to the
+// segment ending at a point, and the reflection of that segment is the one
+// ending at the partner's successor, so that's where they go, as
+// mirrorSegment has them; a segment which crosses the middle is its own
+// reflection, and is left alone. If both ends of a reflection were edited,
+// the first one listed wins.
+func (f *Fractal) mirrorFrom(edited []int) {
+	moved := map[int]bool{}
+	colored := map[int]bool{}
+	for _, i := range edited {
+		j, ok := f.mirror[i]
+		if !ok || j >= len(f.Base) {
+			continue
+		}
+		p := f.Base[i]
+		if !moved[i] {
+			f.Base[j].Vec = pixel.Vec{X: 1 - p.X, Y: p.Y}
+			moved[i], moved[j] = true, true
+		}
+		if k := j + 1; k < len(f.Base) && k != i && !colored[i] {
+			seg := mirrorSegment(p)
+			seg.Vec = f.Base[k].Vec
+			f.Base[k] = seg
+			colored[i], colored[k] = true, true
+		}
+	}
+}
+
+// mirrorSegment yields p with the colors and flags of the reflection of
+// the segment ending at it, which runs the other way, so FlipX is toggled
+// and gradients are reversed. The position is left alone.
+func mirrorSegment(p Point) Point {
+	p.Flags ^= FlipX
+	if p.Flags&HasColor2 != 0 {
+		p.Color, p.Color2 = p.Color2, p.Color
+	}
+	return p
+}
+
+// SelectPoints selects several points at once, so the point operations
+// apply to all of them. The first is the one the UI shows. A point listed
+// more than once is only selected once, so nothing gets done to it twice.
+func (f *Fractal) SelectPoints(indices []int) {
+	if len(indices) == 0 {
+		f.SelectPoint(-1)
+		return
+	}
+	seen := make(map[int]bool, len(indices))
+	unique := make([]int, 0, len(indices))
+	for _, i := range indices {
+		if !seen[i] {
+			seen[i] = true
+			unique = append(unique, i)
+		}
+	}
+	f.multiSelect = unique
+	f.selectedPoint = unique[0]
+	f.showSelected()
+}
+
+// SelectByFlag returns the indices of the base points with the given flag.
+func (f *Fractal) SelectByFlag(flag int) []int {
+	var indices []int
+	for i, p := range f.Base {
+		if p.Flags&flag != 0 {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// selection returns the indices of the selected points, whether that's
+// one or several.
+func (f *Fractal) selection() []int {
+	if len(f.multiSelect) == 0 {
+		if f.selectedPoint < 0 || f.selectedPoint >= len(f.Base) {
+			return nil
+		}
+		return []int{f.selectedPoint}
+	}
+	var indices []int
+	for _, i := range f.multiSelect {
+		if i >= 0 && i < len(f.Base) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// showSelected updates the point controls to match the selected point.
+func (f *Fractal) showSelected() {
+	index := f.selectedPoint
 	if index >= 0 && index < len(f.Base) {
-		f.selectedPoint = index
 		p := f.Base[index]
 		p.UIFlag("FlipX", FlipX)
 		p.UIFlag("FlipY", FlipY)
 		p.UIFlag("Hide", Hide)
 		p.UIFlag("Prune", Prune)
 		p.UIFlag("FixC", FixedC)
+		p.UIFlag("Grad", HasColor2)
+		p.UIFlag("Dash", Dashed)
 		pointElements.SetHidden(false)
 	} else {
 		f.selectedPoint = -1
@@ -593,25 +1917,43 @@ func (f *Fractal) SelectPoint(index int) {
 
 // Save attempts to export a fractal as JSON.
 func (f *Fractal) Save() {
-	jsonstr, err := json.Marshal(*f)
+	filename, err := dialog.File().Filter("Fractals", "frac").Title("Save Fractal").Save()
 	if err != nil {
-		fmt.Printf("json: %s\n", err)
+		fmt.Printf("file select: %s\n", err)
 		return
 	}
-	filename, err := dialog.File().Filter("Fractals", "frac").Title("Save Fractal").Save()
+	err = f.SaveTo(filename)
 	if err != nil {
-		fmt.Printf("file select: %s\n", err)
+		fmt.Printf("%s\n", err)
 		return
 	}
+	fmt.Printf("file saved?\n")
+	// anything autosaved is older than this, now
+	os.Remove(*recoveryPath)
+}
+
+// SaveTo writes the fractal to the named file as JSON.
+func (f *Fractal) SaveTo(filename string) error {
+	jsonstr, err := json.Marshal(*f)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	return writeSaved(filename, jsonstr)
+}
+
+// writeSaved writes an already-marshaled fractal to the named file.
+func writeSaved(filename string, jsonstr []byte) error {
 	file, err := os.Create(filename)
 	if err != nil {
-		fmt.Printf("file create: %s\n", err)
-		return
+		return fmt.Errorf("file create: %s", err)
 	}
 	file.Write(jsonstr)
 	file.WriteString("\n")
-	file.Close()
-	fmt.Printf("file saved?\n")
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("file write: %s", err)
+	}
+	return nil
 }
 
 // Load attempts to load a fractal from a saved file.
@@ -621,28 +1963,149 @@ func (f *Fractal) Load() {
 		fmt.Printf("err: %s\n", err)
 		return
 	}
-	bytes, err := ioutil.ReadFile(filename)
+	err = f.LoadFrom(filename)
 	if err != nil {
-		fmt.Printf("file read: %s\n", err)
-		return
+		fmt.Printf("%s\n", err)
 	}
-	var temp Fractal
-	err = json.Unmarshal(bytes, &temp)
+}
+
+// PrintJSON writes the fractal to w, in the same format Save uses but
+// indented, so it can be pasted somewhere and loaded back with -load -.
+func (f *Fractal) PrintJSON(w io.Writer) error {
+	jsonstr, err := json.MarshalIndent(*f, "", "\t")
 	if err != nil {
-		fmt.Printf("json read: %s\n", err)
-		return
+		return fmt.Errorf("json: %s", err)
 	}
-	f.Base = temp.Base
-	f.Alloc()
+	_, err = fmt.Fprintf(w, "%s\n", jsonstr)
+	return err
 }
 
-func init() {
+// ReadFractal reads a saved fractal from the named file, or from standard
+// input if the name is "-". Only the saved fields are populated; the
+// result isn't allocated or rendered.
+func ReadFractal(filename string) (*Fractal, error) {
+	var bytes []byte
 	var err error
+	if filename == "-" {
+		bytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		bytes, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file read: %s", err)
+	}
+	return parseFractal(bytes, filename)
+}
 
-	face, err = loadTTF("Go-Mono.ttf", 18)
+// parseFractal decodes and validates a saved fractal; name is only used
+// in errors.
+func parseFractal(bytes []byte, name string) (*Fractal, error) {
+	// anything the file doesn't mention keeps its default
+	temp := Fractal{Root: defaultRoot, Settings: DefaultSettings()}
+	err := json.Unmarshal(bytes, &temp)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("json read: %s", err)
+	}
+	err = temp.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("json read: %s: %s", name, err)
+	}
+	return &temp, nil
+}
+
+// Validate checks a fractal's saved fields, such as a hand-edited file might
+// have gotten wrong. Colors are wrapped into the color table's range, since
+// that's what rendering would do with them anyway. Anything else out of
+// range is an error, naming the offending point(s).
+func (f *Fractal) Validate() error {
+	if len(f.Base) == 0 {
+		return errors.New("no base points")
+	}
+	if f.InverseMode < 0 || f.InverseMode >= inverseModes {
+		return fmt.Errorf("unknown inverse mode %d", f.InverseMode)
+	}
+	if f.FlagMode < 0 || f.FlagMode >= flagModes {
+		return fmt.Errorf("unknown flag mode %d", f.FlagMode)
+	}
+	if f.ColorMode < 0 || f.ColorMode >= colorModes {
+		return fmt.Errorf("unknown color mode %d", f.ColorMode)
+	}
+	if f.WrapMode < 0 || f.WrapMode >= wrapModes {
+		return fmt.Errorf("unknown wrap mode %d", f.WrapMode)
+	}
+	if f.GlobalFixedColor < 0 || f.GlobalFixedColor >= globalFixedModes {
+		return fmt.Errorf("unknown global fixed color mode %d", f.GlobalFixedColor)
+	}
+	if f.MaxOOM != 0 {
+		if err := checkMaxOOM(f.MaxOOM); err != nil {
+			return err
+		}
+	}
+	f.Settings.Validate()
+	if !finite(f.Root.Vec) || f.Root.Vec == (pixel.Vec{}) {
+		return fmt.Errorf("root %v isn't usable", f.Root.Vec)
+	}
+	var bad []string
+	for i := range f.Base {
+		f.Base[i].Color = modPlus(f.Base[i].Color, 1024)
+		f.Base[i].Color2 = modPlus(f.Base[i].Color2, 1024)
+		if !finite(f.Base[i].Vec) {
+			bad = append(bad, fmt.Sprintf("point %d: non-finite coordinates", i+1))
+		}
+		if unknown := f.Base[i].Flags &^ allFlags; unknown != 0 {
+			bad = append(bad, fmt.Sprintf("point %d: unknown flags 0x%03x", i+1, unknown))
+		}
+	}
+	if len(bad) != 0 {
+		return errors.New(strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// LoadFrom replaces the fractal's base with the one saved in the named file.
+func (f *Fractal) LoadFrom(filename string) error {
+	temp, err := ReadFractal(filename)
+	if err != nil {
+		return err
+	}
+	f.pushUndo()
+	f.useSaved(temp)
+	f.recordBase()
+	f.fillColorTab()
+	if temp.MaxOOM != 0 && temp.MaxOOM != f.MaxOOM {
+		f.MaxOOM = temp.MaxOOM
+		f.data = make([]Point, 1<<f.MaxOOM, 1<<f.MaxOOM)
+	}
+	f.Alloc()
+	return nil
+}
+
+// useSaved copies the saved fields of another fractal, such as one from
+// ReadFractal, into f. f still needs to be reallocated or rerendered.
+func (f *Fractal) useSaved(saved *Fractal) {
+	f.setBase(saved.Base)
+	f.InverseMode = saved.InverseMode
+	f.FlagMode = saved.FlagMode
+	f.ColorMode = saved.ColorMode
+	f.WrapMode = saved.WrapMode
+	f.GlobalFixedColor = saved.GlobalFixedColor
+	f.Settings = saved.Settings
+	f.Root = saved.Root
+}
+
+// loadFace loads the TTF at path, or, if it can't, falls back to the
+// built-in face, which is small and plain, but beats not running.
+func loadFace(path string, size float64) font.Face {
+	face, err := loadTTF(path, size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "font: %s; using the built-in font\n", err)
+		return basicfont.Face7x13
 	}
+	return face
+}
+
+func init() {
+	face = loadFace("Go-Mono.ttf", 18)
 	atlas = text.NewAtlas(face, text.ASCII)
 
 	textRenderer = text.New(pixel.Vec{}, atlas)
@@ -807,6 +2270,28 @@ func textAt(t pixel.Target, at pixel.Vec, color pixel.RGBA, format string, args
 	return bounds
 }
 
+// ShowGrowth lists the points in each depth, and the running total, in
+// rows starting at the given text position. The last depth is highlighted
+// if it's the point budget that stopped there, with what the next one
+// would have needed.
+func (f *Fractal) ShowGrowth(t pixel.Target, at pixel.Vec) {
+	gray := pixel.RGBA{R: .7, G: .7, B: .7, A: 1}
+	textAt(t, at, gray, "depth %12s %12s", "points", "total")
+	prev := 0
+	for i, total := range f.Totals {
+		color := gray
+		if i == len(f.Totals)-1 && f.overflow != 0 {
+			color = pixel.RGBA{R: 1, G: 1, B: .3, A: 1}
+		}
+		textAt(t, at.Add(pixel.Vec{Y: float64(i + 1)}), color, "%5d %12d %12d", i, total-prev, total)
+		prev = total
+	}
+	if f.overflow != 0 {
+		textAt(t, at.Add(pixel.Vec{Y: float64(len(f.Totals) + 1)}), pixel.RGBA{R: 1, G: .3, B: .3, A: 1},
+			"depth %d would need %d points; MaxOOM %d allows %d", len(f.Totals), f.overflow, f.MaxOOM, 1<<f.MaxOOM)
+	}
+}
+
 func (u UIElement) String() string {
 	return fmt.Sprintf("[%s]", u.label)
 }
@@ -818,6 +2303,68 @@ func (us UIBatch) SetHidden(state bool) {
 	}
 }
 
+// flagKeys select every point with a flag, when pressed with shift.
+var flagKeys = map[pixelgl.Button]int{
+	pixelgl.KeyX: FlipX,
+	pixelgl.KeyY: FlipY,
+	pixelgl.KeyH: Hide,
+	pixelgl.KeyR: Prune,
+	pixelgl.KeyF: FixedC,
+}
+
+// inverseColor is used for the inverse overlay, which would be hard to tell
+// apart from the fractal in the fractal's own colors.
+var inverseColor = pixel.RGBA{R: .6, G: .6, B: .6, A: 1}
+
+// Ctrl and the arrow keys rotate the root by rootStepAngle, or scale it by
+// rootStepScale.
+const (
+	rootStepAngle = math.Pi / 36
+	rootStepScale = 1.05
+)
+
+// bookmarkKeys recall the bookmarks, or set them with ctrl.
+var bookmarkKeys = [9]pixelgl.Button{
+	pixelgl.Key1, pixelgl.Key2, pixelgl.Key3, pixelgl.Key4, pixelgl.Key5,
+	pixelgl.Key6, pixelgl.Key7, pixelgl.Key8, pixelgl.Key9,
+}
+
+// bookmarkZoomTime is how long, in seconds, recalling a bookmark takes to
+// zoom to it.
+const bookmarkZoomTime = 0.4
+
+// fineZoom is how much of a zoom step a scroll step is with ctrl held.
+const fineZoom = 0.25
+
+// The - and = keys step the exposure by exposureStep, within limits.
+const (
+	exposureStep = 1.25
+	minExposure  = 1.0 / 16
+	maxExposure  = 16.0
+)
+
+// With ctrl, the - and = keys step the gamma by gammaStep, within limits.
+const (
+	gammaStep = 0.1
+	minGamma  = 0.25
+	maxGamma  = 4.0
+)
+
+// With shift, the - and = keys step the line width by lineWidthStep canvas
+// pixels, within limits; much thinner, and lines flicker in and out.
+const (
+	lineWidthStep = 0.5
+	minLineWidth  = 0.5
+	maxLineWidth  = 20.0
+)
+
+// The ; and ' keys step the vignette strength by vignetteStep, from 0 to 1.
+const vignetteStep = 0.1
+
+// runErr is how run reports failure, since pixelgl.Run doesn't give it a
+// way to return an error.
+var runErr error
+
 func run() {
 	var err error
 
@@ -831,9 +2378,47 @@ func run() {
 		dragStart    pixel.Vec
 		dragPoint    pixel.Vec
 		lastDrag     pixel.Vec
-		winScale     = pixel.Vec{X: 1000, Y: 800}
-		canScale     = 2.0
-		margin       = 5.0
+		// dragMoved is set once the dragged point has actually moved,
+		// which is when the drag gets an undo entry.
+		dragMoved bool
+		// holding alt when a drag starts drags the color instead, by
+		// colorDragRate canvas pixels per color table entry.
+		colorDrag     bool
+		colorDragFrom pixel.Vec
+		dragColor     int16
+		colorDragRate = 2.0
+		dragAxis      int
+		// snapped is set while the dragged point is snapped to something.
+		snapped bool
+		// onion is the fractal as it was when the current drag started,
+		// if onion skinning is on.
+		onion *Fractal
+		// gal is the gallery of variations, while it's shown; the
+		// variations depend only on the seed, which E with shift bumps.
+		gal         *gallery
+		gallerySeed = time.Now().UnixNano()
+		// recalling a bookmark moves the view from zoomFrom to zoomTo
+		// as zoomT goes from 0 to 1.
+		zoomFrom, zoomTo Bookmark
+		zoomT            = 1.0
+		// heldDepth, if it's not 0, is the depth shift-space is holding
+		// at, not even stepping past it with space in manual mode, until
+		// shift-space lets it go again. An edit starts rendering over,
+		// so it renders back up to it.
+		heldDepth int
+		// explodeStart is when the explode animation started, while it's
+		// running.
+		explodeStart time.Time
+		// viewRect is the part of the window the canvas is shown in.
+		viewRect  = pixel.R(200, 0, 1200, 800)
+		margin    = 5.0
+		lastFrame = time.Now()
+		// lastActive is when something last changed, or might have,
+		// which is compared against what the last frame saw.
+		lastActive     = time.Now()
+		lastSettings   Settings
+		lastGeneration uint64
+		lastMouse      pixel.Vec
 	)
 
 	f, err := os.Create("pdata")
@@ -843,36 +2428,72 @@ func run() {
 	pprof.StartCPUProfile(f)
 	defer pprof.StopCPUProfile()
 
-	fracPortRect := pixel.Rect{Min: pixel.Vec{X: margin, Y: margin}, Max: winScale.Scaled(canScale).Sub(pixel.Vec{X: margin, Y: margin})}
-	fracPortScale := int32(0)
+	if *timingsPath != "" {
+		renderTimings, err = openTimings(*timingsPath)
+		if err != nil {
+			fmt.Printf("timings: %s\n", err)
+		}
+		defer func() {
+			if err := renderTimings.Close(); err != nil {
+				fmt.Printf("timings: %s\n", err)
+			}
+		}()
+	}
+
 	base := []Point{
-		Point{pixel.Vec{X: 0.05, Y: 0.25}, 0, 0},
-		Point{pixel.Vec{X: 0.95, Y: -0.25}, 0, 128},
-		Point{pixel.Vec{X: 1, Y: 0}, 0, 256},
+		Point{pixel.Vec{X: 0.05, Y: 0.25}, 0, 0, 0},
+		Point{pixel.Vec{X: 0.95, Y: -0.25}, 0, 128, 0},
+		Point{pixel.Vec{X: 1, Y: 0}, 0, 256, 0},
+	}
+	frac, err = NewFractal(base, 18)
+	if err != nil {
+		log.Fatal(err)
+	}
+	settings := &frac.Settings
+	settings.PaletteSpeed = *paletteSpeed
+	settings.StreamDepth = *streamDepth
+	if *prerenderDepth >= 0 {
+		settings.PrerenderDepth = *prerenderDepth
 	}
-	frac = NewFractal(base, 18)
-	for i := 0; i < frac.MaxDepth; i++ {
-		if !frac.Render(i) {
-			fmt.Printf("oops, render %d failed.\n", i)
+	if *pixelAspect > 0 {
+		settings.PixelAspect = *pixelAspect
+		settings.Validate()
+	}
+	if *smoothPasses >= 0 {
+		settings.ExportSmooth = *smoothPasses
+		settings.Validate()
+	}
+	frac.prerender()
+	// the canvas is always LogicalSize, and gets scaled to fit the view,
+	// so line widths and such don't depend on the window.
+	if *logicalSize != "" {
+		_, err = fmt.Sscanf(*logicalSize, "%fx%f", &settings.LogicalSize.X, &settings.LogicalSize.Y)
+		if err != nil {
+			fmt.Printf("-logical: %s\n", err)
 		}
+		settings.Validate()
 	}
-	fracRect := frac.AdjustedBounds(fracPortRect, fracPortScale)
-	fracMatrix, _ := NewAffinesBetween(fracRect, fracPortRect)
+	logical := settings.LogicalSize
+	fracPortRect := pixel.Rect{Min: pixel.Vec{X: margin, Y: margin}, Max: logical.Sub(pixel.Vec{X: margin, Y: margin})}
+	fracRect := frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+	fracMatrix := frac.viewMatrix(fracRect, fracPortRect)
 
 	cfg := pixelgl.WindowConfig{
 		Title:  "Pixel Rocks!",
 		Bounds: pixel.R(0, 0, 1200, 800),
-		VSync:  true,
+		VSync:  *vsync,
 	}
 	win, err := pixelgl.NewWindow(cfg)
 	if err != nil {
-		panic(err)
+		runErr = err
+		return
 	}
 	win.SetSmooth(true)
 
-	can := pixelgl.NewCanvas(pixel.Rect{Min: pixel.Vec{}, Max: pixel.Vec{X: 2000, Y: 1600}})
+	can := pixelgl.NewCanvas(pixel.Rect{Min: pixel.Vec{}, Max: logical})
 	win.SetComposeMethod(pixel.ComposePlus)
-	canMatrix := pixel.IM.Scaled(pixel.Vec{}, 0.5).Moved(pixel.Vec{X: 700, Y: 400})
+	canScale := math.Min(viewRect.W()/logical.X, viewRect.H()/logical.Y)
+	canMatrix := pixel.IM.Scaled(pixel.Vec{}, canScale).Moved(viewRect.Center())
 
 	imd := imdraw.New(nil)
 	imd.SetMatrix(fracMatrix)
@@ -881,11 +2502,18 @@ func run() {
 
 	pointElements = append(pointElements, button(pixel.Vec{X: 8, Y: 4}, "AddPoint", func() { frac.AddPoint() }, "Add"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 12, Y: 4}, "DelPoint", func() { frac.DelPoint() }, "Del"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 16, Y: 4}, "MergePoint", func() { frac.MergePoint() }, "Merge"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 0, Y: 15}, "FlipX", func() { frac.Toggle(FlipX) }, "FlipX"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 8, Y: 15}, "FlipY", func() { frac.Toggle(FlipY) }, "FlipY"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 00, Y: 16}, "Hide", func() { frac.Toggle(Hide) }, "Hide"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 8, Y: 16}, "Prune", func() { frac.Toggle(Prune) }, "Prune"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 0, Y: 17}, "FixC", func() { frac.Toggle(FixedC) }, "FixC"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 8, Y: 17}, "Grad", func() { frac.Toggle(HasColor2) }, "Grad"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 16, Y: 15}, "Dash", func() { frac.Toggle(Dashed) }, "Dash"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 0, Y: 12}, "<<2", func() { frac.Color2Change(-16) }, "<<"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 3, Y: 12}, "<2", func() { frac.Color2Change(-1) }, "<"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 5, Y: 12}, ">2", func() { frac.Color2Change(1) }, ">"))
+	pointElements = append(pointElements, button(pixel.Vec{X: 7, Y: 12}, ">>2", func() { frac.Color2Change(16) }, ">>"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 0, Y: 9}, "<<", func() { frac.ColorChange(-16) }, "<<"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 3, Y: 9}, "<", func() { frac.ColorChange(-1) }, "<"))
 	pointElements = append(pointElements, button(pixel.Vec{X: 5, Y: 9}, ">", func() { frac.ColorChange(1) }, ">"))
@@ -897,23 +2525,474 @@ func run() {
 
 	button(pixel.Vec{X: 13, Y: 3}, "-MaxOOM", func() { frac.MaxOOMChange(-1) }, "-")
 	button(pixel.Vec{X: 14, Y: 3}, "+MaxOOM", func() { frac.MaxOOMChange(1) }, "+")
+	button(pixel.Vec{X: 13, Y: 1}, "Inverse", func() { frac.InverseModeChange() }, "Inv")
+	button(pixel.Vec{X: 13, Y: 0}, "FlagMode", func() { frac.FlagModeChange() }, "Flg")
+	button(pixel.Vec{X: 13, Y: 2}, "ColorMode", func() { frac.ColorModeChange() }, "Col")
 
 	frac.SelectPoint(-1)
+	if *preset != "" {
+		base, err := presetBase(*preset)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+		} else {
+			frac.Base = base
+			frac.Alloc()
+		}
+	}
+	if *loadPath != "" {
+		err = frac.LoadFrom(*loadPath)
+		if err != nil {
+			fmt.Printf("load: %s\n", err)
+		}
+	} else {
+		offerRecovery(frac)
+	}
+	if *targetDepth > 0 {
+		frac.DepthChange(*targetDepth)
+	}
+	// a replay starts from whatever was loaded; with -replaylive, it's
+	// fed to the loop as the events come due
+	var replay []EditEvent
+	var replayStart time.Time
+	if *replayPath != "" {
+		replay, err = ReadSession(*replayPath)
+		if err != nil {
+			fmt.Printf("replay: %s\n", err)
+		}
+		if !*replayLive {
+			if err := frac.Replay(replay); err != nil {
+				fmt.Printf("%s\n", err)
+			}
+			replay = nil
+		}
+		replayStart = time.Now()
+	}
+	if *recordPath != "" {
+		frac.session, err = openSession(*recordPath)
+		if err != nil {
+			fmt.Printf("record: %s\n", err)
+		}
+		defer func() {
+			if err := frac.session.Close(); err != nil {
+				fmt.Printf("record: %s\n", err)
+			}
+		}()
+	}
+	saver := &autoSaver{path: *recoveryPath, interval: *autoSave}
+	if *statsAddr != "" {
+		serveStats(*statsAddr)
+	}
+
+	// with VSync, the loop is paced by the monitor; otherwise, either
+	// -maxfps caps it, or we at least yield a little each frame.
+	var frameTick <-chan time.Time
+	frameCap := "vsync"
+	if *maxFPS > 0 {
+		frameTicker := time.NewTicker(time.Second / time.Duration(*maxFPS))
+		defer frameTicker.Stop()
+		frameTick = frameTicker.C
+		frameCap = fmt.Sprintf("%d fps", *maxFPS)
+	} else if !*vsync {
+		frameCap = "none"
+	}
+
+	// each depth is composited onto the window separately; when they're
+	// added up, black adds nothing, but to draw one over another, the rest
+	// of the canvas has to be transparent
+	clearCanvas := func() {
+		if settings.Overlay {
+			can.Clear(pixel.RGBA{})
+		} else {
+			can.Clear(pixel.RGBA{R: 0, G: 0, B: 0, A: 255})
+		}
+	}
+	// with a gamma, the depths are added up in comp instead, which is
+	// corrected and drawn onto the window once they're all there, so the
+	// gamma applies to the finished composite, as it does in exports
+	comp := pixelgl.NewCanvas(can.Bounds())
+	var linesTarget pixel.Target = win
+	linesMatrix := canMatrix
+	flushCanvas := func() {
+		can.Draw(linesTarget, linesMatrix)
+		clearCanvas()
+	}
+
+	// colorField takes a typed color for the selected point(s), started
+	// with Enter.
+	colorField := &textField{allowed: "-0123456789"}
+
+	// resetView zooms back out to fit the whole fractal, in case things
+	// have gotten lost.
+	resetView := func() {
+		settings.Scale = 0
+		settings.Pan = pixel.Vec{}
+		zoomT = 1
+		if !dragging {
+			fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+			fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
+			imd.SetMatrix(fracMatrix)
+		}
+	}
+	// offscreenSince is when the fractal went out of view, if it has.
+	var offscreenSince time.Time
 
 	second := time.Tick(time.Second)
 	for !win.Closed() {
+		now := time.Now()
+		elapsed := now.Sub(lastFrame).Seconds()
+		lastFrame = now
+		ctrl := win.Pressed(pixelgl.KeyLeftControl) || win.Pressed(pixelgl.KeyRightControl)
+		shift := win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift)
+		typing := colorField.Update(win)
+		if !typing {
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyX) && explodeStart.IsZero() {
+				explodeStart = time.Now()
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyP) {
+				settings.AutoRotatePalette = !settings.AutoRotatePalette
+			}
+			if win.JustPressed(pixelgl.KeyO) {
+				settings.OnlyDeepest = !settings.OnlyDeepest
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyZ) {
+				frac.Undo()
+			}
+			if !shift && win.JustPressed(pixelgl.KeyR) {
+				if ctrl {
+					frac.StashReference()
+				} else {
+					frac.SwapReference()
+				}
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyP) {
+				frac.ExportPaletteDialog()
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyG) {
+				frac.ExportPaletteGIFDialog()
+			}
+			if win.JustPressed(pixelgl.KeyB) {
+				// bake in the deepest depth shown, or the deepest that fits
+				depth := frac.FlattenDepth()
+				if settings.DepthCap != 0 {
+					depth = settings.DepthCap
+				}
+				if err := frac.FlattenToBase(depth); err != nil {
+					fmt.Printf("%s\n", err)
+				}
+			}
+			if win.JustPressed(pixelgl.KeyLeftBracket) && settings.FocusDepth > 1 {
+				settings.FocusDepth--
+			}
+			if win.JustPressed(pixelgl.KeyRightBracket) && settings.FocusDepth < frac.MaxDepth-1 {
+				settings.FocusDepth++
+			}
+			if win.JustPressed(pixelgl.KeyL) {
+				settings.LogDepthColor = !settings.LogDepthColor
+			}
+			if !ctrl && !shift && win.JustPressed(pixelgl.KeyMinus) && settings.Exposure > minExposure {
+				settings.Exposure /= exposureStep
+			}
+			if !ctrl && !shift && win.JustPressed(pixelgl.KeyEqual) && settings.Exposure < maxExposure {
+				settings.Exposure *= exposureStep
+			}
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyMinus) {
+				settings.Gamma = math.Max(minGamma, math.Round((settings.Gamma-gammaStep)*100)/100)
+			}
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyEqual) {
+				settings.Gamma = math.Min(maxGamma, math.Round((settings.Gamma+gammaStep)*100)/100)
+			}
+			if shift && win.JustPressed(pixelgl.KeyMinus) {
+				settings.LineWidth = math.Max(minLineWidth, settings.LineWidth-lineWidthStep)
+			}
+			if shift && win.JustPressed(pixelgl.KeyEqual) {
+				settings.LineWidth = math.Min(maxLineWidth, settings.LineWidth+lineWidthStep)
+			}
+			if win.JustPressed(pixelgl.Key0) {
+				settings.HighlightChanges = !settings.HighlightChanges
+			}
+			if win.JustPressed(pixelgl.KeyTab) {
+				settings.FlipYOutput = !settings.FlipYOutput
+				fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
+				imd.SetMatrix(fracMatrix)
+			}
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyH) {
+				settings.CapPolicy = (settings.CapPolicy + 1) % capPolicies
+			}
+			if win.JustPressed(pixelgl.KeySlash) {
+				if shift {
+					if err := frac.MirrorBase(frac.selectedPoint); err != nil {
+						fmt.Printf("%s\n", err)
+					}
+				} else {
+					frac.MirrorChange()
+				}
+			}
+			if win.JustPressed(pixelgl.KeyBackslash) {
+				switch {
+				case ctrl:
+					settings.HiddenDepths = 0
+				case shift:
+					settings.DepthHiddenChange(settings.FocusDepth)
+				default:
+					settings.WireframeChange()
+				}
+			}
+			if win.JustPressed(pixelgl.KeySemicolon) {
+				settings.Vignette = math.Max(0, settings.Vignette-vignetteStep)
+			}
+			if win.JustPressed(pixelgl.KeyApostrophe) {
+				settings.Vignette = math.Min(1, settings.Vignette+vignetteStep)
+			}
+			if shift {
+				for key, flag := range flagKeys {
+					if win.JustPressed(key) {
+						frac.SelectPoints(frac.SelectByFlag(flag))
+					}
+				}
+			}
+			if shift && win.JustPressed(pixelgl.KeyJ) {
+				frac.ExportGeoJSONDialog()
+			}
+			if !shift && win.JustPressed(pixelgl.KeyJ) {
+				if err := frac.PrintJSON(os.Stdout); err != nil {
+					fmt.Printf("%s\n", err)
+				}
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyE) {
+				if shift {
+					frac.ExportTileDialog()
+				} else {
+					frac.ExportPNGDialog()
+				}
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyE) {
+				switch {
+				case shift:
+					gallerySeed++
+					gal = newGallery(frac, viewRect, settings.GallerySize, settings.GalleryJitter, gallerySeed)
+				case gal == nil:
+					gal = newGallery(frac, viewRect, settings.GallerySize, settings.GalleryJitter, gallerySeed)
+				default:
+					gal = nil
+				}
+			}
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyF) {
+				frac.GlobalFixedColorChange()
+			}
+			if !ctrl && !shift && win.JustPressed(pixelgl.KeyF) {
+				if settings.ColorFreezeDepth < 0 {
+					settings.ColorFreezeDepth = settings.FocusDepth
+				} else {
+					settings.ColorFreezeDepth = -1
+				}
+				frac.Changed()
+			}
+			if win.JustPressed(pixelgl.KeyT) {
+				frac.LinearColorChange()
+			}
+			if win.JustPressed(pixelgl.KeyQ) {
+				if ctrl {
+					settings.PixelSize = pixelSizeStep(settings.PixelSize, !shift)
+				} else {
+					settings.Posterize = posterizeStep(settings.Posterize, !shift)
+				}
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyD) {
+				frac.ClonePoint()
+			}
+			if win.JustPressed(pixelgl.KeyU) {
+				settings.SinglePass = !settings.SinglePass
+			}
+			if win.JustPressed(pixelgl.KeyW) {
+				if shift {
+					frac.WrapModeChange()
+				} else {
+					settings.RetainGeometry = !settings.RetainGeometry
+				}
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyA) {
+				frac.SubdivideAll()
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyS) {
+				settings.ShowGrowth = !settings.ShowGrowth
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyS) {
+				frac.ExportSVGDialog(shift)
+			}
+			if ctrl && !shift && win.JustPressed(pixelgl.KeyC) {
+				settings.ShowHull = !settings.ShowHull
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyC) {
+				if shift {
+					settings.ShowCentroid = !settings.ShowCentroid
+				} else {
+					settings.ClampDrag = !settings.ClampDrag
+				}
+			}
+			if win.JustPressed(pixelgl.KeyHome) {
+				resetView()
+			}
+			for i, key := range bookmarkKeys {
+				if !win.JustPressed(key) {
+					continue
+				}
+				if ctrl {
+					settings.Bookmarks[i] = &Bookmark{Scale: settings.Scale, Pan: settings.Pan, DepthCap: settings.DepthCap}
+				} else if b := settings.Bookmarks[i]; b != nil {
+					zoomFrom, zoomTo, zoomT = Bookmark{Scale: settings.Scale, Pan: settings.Pan}, *b, 0
+					settings.DepthCap = b.DepthCap
+				}
+			}
+			if !ctrl && !dragging {
+				// the arrows pan by a tenth of the view
+				var pan pixel.Vec
+				switch {
+				case win.JustPressed(pixelgl.KeyLeft):
+					pan.X = -fracRect.W() / 10
+				case win.JustPressed(pixelgl.KeyRight):
+					pan.X = fracRect.W() / 10
+				case win.JustPressed(pixelgl.KeyUp):
+					pan.Y = fracRect.H() / 10
+				case win.JustPressed(pixelgl.KeyDown):
+					pan.Y = -fracRect.H() / 10
+				}
+				if pan != (pixel.Vec{}) {
+					settings.Pan = settings.Pan.Add(pan)
+					zoomT = 1
+					fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+					fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
+					imd.SetMatrix(fracMatrix)
+				}
+			}
+			if ctrl {
+				switch {
+				case win.JustPressed(pixelgl.KeyLeft):
+					frac.RootChange(rootStepAngle, 1)
+				case win.JustPressed(pixelgl.KeyRight):
+					frac.RootChange(-rootStepAngle, 1)
+				case win.JustPressed(pixelgl.KeyUp):
+					frac.RootChange(0, rootStepScale)
+				case win.JustPressed(pixelgl.KeyDown):
+					frac.RootChange(0, 1/rootStepScale)
+				}
+			}
+			if win.JustPressed(pixelgl.KeyK) {
+				if shift {
+					settings.SnapPoints = !settings.SnapPoints
+				} else {
+					settings.SnapEndpoints = !settings.SnapEndpoints
+				}
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyI) {
+				frac.ShowInverseChange()
+			}
+			if ctrl && win.JustPressed(pixelgl.KeyI) {
+				frac.ImportSVGDialog()
+			}
+			if win.JustPressed(pixelgl.KeyN) {
+				if shift {
+					settings.ClosedCurve = !settings.ClosedCurve
+				} else {
+					settings.DrawOriginSegment = !settings.DrawOriginSegment
+				}
+			}
+			if !ctrl && win.JustPressed(pixelgl.KeyG) {
+				settings.OnionSkin = !settings.OnionSkin
+			}
+			if win.JustPressed(pixelgl.KeyV) {
+				if shift {
+					settings.ShowArrows = !settings.ShowArrows
+				} else {
+					settings.ShowVertices = !settings.ShowVertices
+				}
+			}
+			if shift && win.JustPressed(pixelgl.KeySpace) {
+				if heldDepth == 0 {
+					heldDepth = int(math.Max(1, float64(frac.Depth)))
+				} else {
+					heldDepth = 0
+				}
+			}
+			if win.JustPressed(pixelgl.KeyM) {
+				if shift {
+					settings.ShowMinimap = !settings.ShowMinimap
+				} else {
+					settings.ManualDepth = !settings.ManualDepth
+				}
+			}
+			if win.JustPressed(pixelgl.KeyComma) {
+				if settings.DepthCap == 0 {
+					settings.DepthCap = frac.Depth
+				}
+				if settings.DepthCap > 1 {
+					settings.DepthCap--
+				}
+			}
+			if win.JustPressed(pixelgl.KeyPeriod) && settings.DepthCap != 0 {
+				settings.DepthCap++
+				if settings.DepthCap >= frac.MaxDepth {
+					settings.DepthCap = 0
+				}
+			}
+			if win.JustPressed(pixelgl.KeyEnter) && frac.selectedPoint >= 0 {
+				colorField.Focus(func(text string) {
+					c, err := strconv.ParseInt(text, 10, 16)
+					if err != nil {
+						fmt.Printf("color: %s\n", err)
+						return
+					}
+					frac.SetColorAbsolute(int16(c))
+				})
+			}
+		}
+		if settings.AutoRotatePalette {
+			settings.PaletteOffset = math.Mod(settings.PaletteOffset+elapsed*settings.PaletteSpeed, 1024)
+			if settings.PaletteOffset < 0 {
+				settings.PaletteOffset += 1024
+			}
+		}
+		paletteShift := int16(settings.PaletteOffset)
+		if zoomT < 1 {
+			zoomT = math.Min(1, zoomT+elapsed/bookmarkZoomTime)
+			// ease in and out
+			view := zoomFrom.towards(zoomTo, zoomT*zoomT*(3-2*zoomT))
+			settings.Scale, settings.Pan = view.Scale, view.Pan
+			if !dragging {
+				fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+				fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
+				imd.SetMatrix(fracMatrix)
+			}
+		}
 		scrolled := win.MouseScroll()
 		mousePos := win.MousePosition()
-		canPos := canMatrix.Unproject(mousePos).Add(pixel.Vec{X: 1000, Y: 800})
+		canPos := canMatrix.Unproject(mousePos).Add(logical.Scaled(0.5))
+		// base points are edited in the base's coordinates
+		editMatrix := frac.RootMatrix().Chained(fracMatrix)
 		if scrolled.Y != 0 {
-			fracPortScale += int32(scrolled.Y)
+			// trackpads scroll in fractions of a step, which is why
+			// the scale isn't an integer; ctrl zooms more finely still.
+			if ctrl {
+				scrolled.Y *= fineZoom
+			}
+			settings.Scale += scrolled.Y
+			zoomT = 1
 			if !dragging {
-				fracRect = frac.AdjustedBounds(fracPortRect, fracPortScale)
-				fracMatrix, _ = NewAffinesBetween(fracRect, fracPortRect)
+				fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+				fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
 				imd.SetMatrix(fracMatrix)
 			}
 		}
-		if win.JustPressed(pixelgl.MouseButtonLeft) {
+		if gal != nil && win.JustPressed(pixelgl.MouseButtonLeft) {
+			// while the gallery's up, clicks are for picking from it
+			if i := gal.Hit(mousePos); i >= 0 {
+				frac.pushUndo()
+				frac.setBase(gal.bases[i])
+				frac.recordBase()
+				frac.SelectPoint(-1)
+				frac.Alloc()
+				gal = nil
+			}
+		} else if win.JustPressed(pixelgl.MouseButtonLeft) {
 			found := false
 			for _, element := range UIElements {
 				if element.bounds.Contains(mousePos) && element.enabled {
@@ -923,26 +3002,52 @@ func run() {
 				}
 			}
 
+			// the minimap is on top of the canvas, so it gets the click
+			if settings.ShowMinimap && minimapRect(viewRect).Contains(mousePos) {
+				found = true
+			}
 			if !found && canPos.X >= 0 {
 				// find click within the canvas space
-				leastDist := 999999.0
-				pidx := -1
-				for i, p := range frac.Base {
-					pv := fracMatrix.Project(pixel.Vec{X: p.X, Y: p.Y})
-					dist := math.Hypot(pv.X-canPos.X, pv.Y-canPos.Y)
-					if dist < 30 && dist < leastDist {
-						leastDist = dist
-						pidx = i
-					}
+				pidx := frac.HitPoint(canPos, editMatrix, pickRadius/canScale)
+				if ctrl && pidx > -1 && frac.selectedPoint > -1 {
+					// ctrl-click adds to the selection
+					frac.SelectPoints(append([]int{pidx}, frac.selection()...))
+				} else {
+					frac.SelectPoint(pidx)
 				}
-				frac.SelectPoint(pidx)
 				if pidx > -1 {
-					dragStart = fracMatrix.Unproject(canPos)
+					dragStart = editMatrix.Unproject(canPos)
 					dragPoint = frac.Base[pidx].Vec
 					lastDrag = dragPoint
 					dragging = true
+					dragMoved = false
+					colorDrag = win.Pressed(pixelgl.KeyLeftAlt) || win.Pressed(pixelgl.KeyRightAlt)
+					colorDragFrom = canPos
+					dragColor = frac.Base[pidx].Color
+					if settings.OnionSkin {
+						onion = frac.onionSkin()
+					}
+					switch {
+					case win.Pressed(pixelgl.KeyX):
+						dragAxis = dragXOnly
+					case win.Pressed(pixelgl.KeyY):
+						dragAxis = dragYOnly
+					case win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift):
+						dragAxis = dragDominant
+					default:
+						dragAxis = dragFree
+					}
 				}
 			}
+		} else if gal == nil && win.JustPressed(pixelgl.MouseButtonRight) && canPos.X >= 0 {
+			// right-click traces a segment of the deepest depth shown
+			// back up to the root
+			depth := frac.Depth
+			if settings.DepthCap != 0 && settings.DepthCap < depth {
+				depth = settings.DepthCap
+			}
+			index, _ := frac.HitSegment(canPos, fracMatrix, depth)
+			frac.TraceAncestors(depth, index)
 		} else if win.JustReleased(pixelgl.MouseButtonLeft) {
 			for _, element := range UIElements {
 				if element.state == Pressed {
@@ -955,41 +3060,164 @@ func run() {
 					}
 				}
 			}
-			if dragging {
-				fracRect = frac.AdjustedBounds(fracPortRect, fracPortScale)
-				fracMatrix, _ = NewAffinesBetween(fracRect, fracPortRect)
+			if dragging && dragMoved {
+				frac.recordBase()
+				fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+				fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
 				imd.SetMatrix(fracMatrix)
 			}
 			dragging = false
+			snapped = false
+			onion = nil
 		}
 		if dragging {
-			current := fracMatrix.Unproject(canPos)
+			current := editMatrix.Unproject(canPos)
 			if current != lastDrag {
 				if frac.selectedPoint >= 0 && frac.selectedPoint < len(frac.Base) {
-					frac.Base[frac.selectedPoint].Vec = dragPoint.Add(current.Sub(dragStart))
+					if !dragMoved {
+						frac.pushUndo()
+						dragMoved = true
+					}
+					if colorDrag {
+						c := float64(dragColor) + (canPos.Y-colorDragFrom.Y)/colorDragRate
+						frac.Base[frac.selectedPoint].Color = int16(math.Max(0, math.Min(1023, c)))
+					} else {
+						delta := current.Sub(dragStart)
+						if dragAxis == dragDominant && delta != (pixel.Vec{}) {
+							if math.Abs(delta.X) >= math.Abs(delta.Y) {
+								dragAxis = dragXOnly
+							} else {
+								dragAxis = dragYOnly
+							}
+						}
+						switch dragAxis {
+						case dragXOnly:
+							delta.Y = 0
+						case dragYOnly:
+							delta.X = 0
+						}
+						target := dragPoint.Add(delta)
+						target, snapped = frac.Snap(target, editMatrix, frac.selectedPoint)
+						if settings.ClampDrag {
+							target = clampVec(target, settings.DragBounds)
+						}
+						frac.Base[frac.selectedPoint].Vec = target
+					}
+					frac.mirrorFrom([]int{frac.selectedPoint})
 					frac.Changed()
 				}
 				lastDrag = current
 			}
 		}
-		if frac.Depth < frac.MaxDepth-1 && !dragging {
-			frac.Render(frac.Depth + 1)
-			fracRect = frac.AdjustedBounds(fracPortRect, fracPortScale)
-			fracMatrix, _ = NewAffinesBetween(fracRect, fracPortRect)
+		if len(replay) > 0 && !dragging {
+			due := 0
+			for due < len(replay) && replay[due].At <= time.Since(replayStart) {
+				due++
+			}
+			if err := frac.Replay(replay[:due]); err != nil {
+				fmt.Printf("%s\n", err)
+				replay = nil
+			} else {
+				replay = replay[due:]
+			}
+		}
+		nextDepth := !settings.ManualDepth || (!shift && win.JustPressed(pixelgl.KeySpace))
+		if heldDepth != 0 {
+			nextDepth = frac.Depth < heldDepth
+		}
+		if nextDepth && frac.Depth < frac.MaxDepth-1 && !dragging {
+			if depth := frac.Depth + 1; !frac.Render(depth) {
+				frac.renderFailed(depth)
+			}
+			fracRect = frac.AdjustedBounds(fracPortRect, settings.Scale, settings.Pan)
+			fracMatrix = frac.viewMatrix(fracRect, fracPortRect)
 			imd.SetMatrix(fracMatrix)
 		}
+		// the view doesn't follow the fractal during a drag, so it can
+		// get dragged right out of it
+		if onscreen(frac.Bounds, fracMatrix, fracPortRect) {
+			offscreenSince = time.Time{}
+		} else if offscreenSince.IsZero() {
+			offscreenSince = time.Now()
+		} else if !dragging && time.Since(offscreenSince) > offscreenRecenter {
+			resetView()
+			offscreenSince = time.Time{}
+		}
 		win.SetComposeMethod(pixel.ComposeOver)
 		win.Clear(pixel.RGBA{R: 0, G: 0, B: 0, A: 255})
 		textAt(win, pixel.Vec{X: 0, Y: 0}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
-			"Scale: %d", fracPortScale)
+			"Scale: %.1f Pan: %.3g, %.3g", settings.Scale, settings.Pan.X, settings.Pan.Y)
 		textAt(win, pixel.Vec{X: 0, Y: 1}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
 			"Depth: %d/%d", frac.Depth, frac.MaxDepth-1)
+		if heldDepth != 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 28}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Depth: held at %d (shift-space)", heldDepth)
+		} else if settings.ManualDepth {
+			textAt(win, pixel.Vec{X: 0, Y: 28}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Depth: manual (space)")
+		}
+		if settings.Exposure != 1 || settings.Gamma != 1 {
+			textAt(win, pixel.Vec{X: 0, Y: 23}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Exposure: %.2f, gamma %.2f", settings.Exposure, settings.Gamma)
+		}
+		if settings.Wireframe {
+			textAt(win, pixel.Vec{X: 0, Y: 18}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"View: wireframe")
+		}
+		capNote := ""
+		if settings.CapPolicy != CapSharp {
+			capNote = ", caps: " + capPolicyNames[settings.CapPolicy]
+		}
+		textAt(win, pixel.Vec{X: 0, Y: 14}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"Line width: %.1f%s", settings.LineWidth, capNote)
+		if settings.Vignette != 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 19}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Vignette: %.1f", settings.Vignette)
+		}
+		if settings.StreamDepth > 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 26}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Streaming: depth %d", settings.StreamDepth)
+		}
+		if settings.DepthCap != 0 || settings.OnlyDeepest {
+			shown := "all"
+			if settings.OnlyDeepest {
+				shown = "deepest"
+			}
+			if settings.DepthCap != 0 {
+				shown = fmt.Sprintf("%s to %d", shown, settings.DepthCap)
+			}
+			textAt(win, pixel.Vec{X: 0, Y: 29}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Showing: %s", shown)
+		}
 		textAt(win, pixel.Vec{X: 0, Y: 2}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
 			"Points: %d", frac.Total)
 		textAt(win, pixel.Vec{X: 0, Y: 3}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
 			"Max: %d", 1<<frac.MaxOOM)
 		textAt(win, pixel.Vec{X: 0, Y: 4}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
 			"Len: %d", len(frac.Base))
+		textAt(win, pixel.Vec{X: 17, Y: 1}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"%s", inverseModeNames[frac.InverseMode])
+		textAt(win, pixel.Vec{X: 17, Y: 0}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"%s", flagModeNames[frac.FlagMode])
+		colorMode := colorModeNames[frac.ColorMode]
+		if frac.ColorMode == ColorByDepth && settings.LogDepthColor {
+			colorMode += " (log)"
+		}
+		if frac.reference != nil {
+			reference := "Ref: stashed"
+			if frac.referenceOn {
+				reference = "Ref: showing"
+			}
+			textAt(win, pixel.Vec{X: 17, Y: 3}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1}, "%s", reference)
+		}
+		if frac.WrapMode != WrapAround {
+			colorMode += ", " + wrapModeNames[frac.WrapMode]
+		}
+		if frac.GlobalFixedColor != FixedPerPoint {
+			colorMode += ", " + globalFixedNames[frac.GlobalFixedColor]
+		}
+		textAt(win, pixel.Vec{X: 17, Y: 2}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"%s", colorMode)
 		uiBatch.Clear()
 		for _, e := range UIElements {
 			if !e.hidden {
@@ -1001,67 +3229,279 @@ func run() {
 			p := frac.Base[frac.selectedPoint]
 			textAt(win, pixel.Vec{X: 0, Y: 5}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
 				"Point: %d", frac.selectedPoint+1)
-			textAt(win, pixel.Vec{X: 0, Y: 6}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
-				"X: %-+6.3f", p.X)
-			textAt(win, pixel.Vec{X: 0, Y: 7}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
-				"Y: %-+6.3f", p.Y)
+			// an axis-locked drag only shows the coordinate it's changing
+			locked := dragging && !colorDrag
+			if !locked || dragAxis != dragYOnly {
+				textAt(win, pixel.Vec{X: 0, Y: 6}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+					"X: %-+6.3f", p.X)
+			}
+			if !locked || dragAxis != dragXOnly {
+				textAt(win, pixel.Vec{X: 0, Y: 7}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+					"Y: %-+6.3f", p.Y)
+			}
 			col := modPlus(p.Color, 1024)
-			textAt(win, pixel.Vec{X: 0, Y: 8}, frac.colorTab[col], "Color: %d", p.Color)
+			if colorField.focused {
+				textAt(win, pixel.Vec{X: 0, Y: 8}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
+					"Color: %s_", colorField.text)
+			} else {
+				textAt(win, pixel.Vec{X: 0, Y: 8}, frac.colorTab[col], "Color: %d", p.Color)
+			}
+			if p.Flags&HasColor2 != 0 {
+				textAt(win, pixel.Vec{X: 0, Y: 11}, frac.colorTab[modPlus(p.Color2, 1024)], "End color: %d", p.Color2)
+			}
+			if n := len(frac.selection()); n > 1 {
+				textAt(win, pixel.Vec{X: 0, Y: 10}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+					"Selected: %d points", n)
+			}
+			if j, ok := frac.mirror[frac.selectedPoint]; ok {
+				textAt(win, pixel.Vec{X: 0, Y: 13}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+					"Mirrors point %d", j+1)
+			}
 		}
 		textAt(win, pixel.Vec{X: 0, Y: 32}, pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
 			"FPS: %d\n[%.1f avg %ds]", lastFPS, averageFPS, totalSeconds)
-		can.Clear(pixel.RGBA{R: 0, G: 0, B: 0, A: 255})
+		textAt(win, pixel.Vec{X: 0, Y: 31}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"Cap: %s", frameCap)
+		if !offscreenSince.IsZero() {
+			textAt(win, pixel.Vec{X: 19, Y: 32}, pixel.RGBA{R: 1, G: .6, B: .3, A: 1},
+				"fractal offscreen; press Home to recenter")
+		}
+		if frac.Diverging() {
+			textAt(win, pixel.Vec{X: 0, Y: 25}, pixel.RGBA{R: 1, G: .3, B: .3, A: 1},
+				"fractal is diverging")
+		}
+		var looks []string
+		if settings.Posterize != 0 {
+			looks = append(looks, fmt.Sprintf("Posterize: %d colors", settings.Posterize))
+		}
+		if settings.PixelSize > 1 {
+			looks = append(looks, fmt.Sprintf("Pixel art: %dx", settings.PixelSize))
+		}
+		if len(looks) != 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 20}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"%s", strings.Join(looks, ", "))
+		}
+		if settings.ColorFreezeDepth >= 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 21}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Colors frozen past depth %d", settings.ColorFreezeDepth)
+		}
+		if len(frac.coincident) != 0 {
+			pair := frac.coincident[0]
+			first := "origin"
+			if pair[0] >= 0 {
+				first = fmt.Sprintf("point %d", pair[0]+1)
+			}
+			textAt(win, pixel.Vec{X: 0, Y: 22}, pixel.RGBA{R: 1, G: .6, B: .3, A: 1},
+				"%s and point %d coincide", first, pair[1]+1)
+		}
+		if bad := frac.NonFinite(); bad >= 0 {
+			textAt(win, pixel.Vec{X: 0, Y: 24}, pixel.RGBA{R: 1, G: .3, B: .3, A: 1},
+				"point %d is not finite; not rendering", bad+1)
+		}
+		focusNote := ""
+		if settings.ShowVertices {
+			focusNote = ", vertices"
+			if len(frac.Points(settings.FocusDepth)) > maxVertexMarkers {
+				focusNote = ", too many vertices"
+			}
+		}
+		if settings.ShowArrows {
+			focusNote += ", arrows"
+			if len(frac.Points(settings.FocusDepth)) > maxArrows {
+				focusNote += " (too many)"
+			}
+		}
+		if settings.ShowCentroid && frac.Depth >= 1 {
+			focusNote += fmt.Sprintf(", balance %.3f", frac.Balance(settings.FocusDepth))
+		}
+		if settings.ShowHull {
+			focusNote += ", hull"
+		}
+		if settings.HiddenDepths != 0 {
+			focusNote += "; hiding " + settings.hiddenDepthList()
+		}
+		textAt(win, pixel.Vec{X: 0, Y: 27}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+			"Focus: %d%s", settings.FocusDepth, focusNote)
+		if settings.AutoRotatePalette {
+			textAt(win, pixel.Vec{X: 0, Y: 30}, pixel.RGBA{R: .7, G: .7, B: .7, A: 1},
+				"Palette: %+.0f/s", settings.PaletteSpeed)
+		}
+		can.Clear(settings.Background)
 		can.Draw(win, canMatrix)
-		win.SetComposeMethod(pixel.ComposePlus)
-		for i := 1; i <= frac.Depth; i++ {
-			imd.Clear()
-			points := frac.Points(i)
-			prev := &Point{Vec: pixel.Vec{}, Color: points[len(points)-1].Color}
-			drawing := false
-			for j := 0; j < len(points); j++ {
-				if points[j].Flags&Hide != 0 {
-					if drawing {
-						imd.Line(2 / fracMatrix[0])
-						drawing = false
-					}
-					prev = &points[j]
-					continue
-				}
-				if prev != nil {
-					imd.Color = frac.colorTab[prev.Color]
-					imd.Push(prev.Vec)
-					prev = nil
-				}
-				imd.Color = frac.colorTab[points[j].Color]
-				imd.Push(points[j].Vec)
-				drawing = true
+		clearCanvas()
+		if !settings.Overlay {
+			win.SetComposeMethod(pixel.ComposePlus)
+		}
+		gammaPass := settings.Gamma != 1
+		if gammaPass {
+			comp.Clear(pixel.RGBA{})
+			if settings.Overlay {
+				comp.SetComposeMethod(pixel.ComposeOver)
+			} else {
+				comp.SetComposeMethod(pixel.ComposePlus)
 			}
-			if drawing {
-				imd.Line(2 / fracMatrix[0])
+			linesTarget, linesMatrix = comp, pixel.IM.Moved(comp.Bounds().Center())
+		} else {
+			linesTarget, linesMatrix = win, canMatrix
+		}
+		drawOpts := DrawOptions{
+			LineWidth:     settings.LineWidth,
+			PaletteShift:  paletteShift,
+			DepthCap:      settings.DepthCap,
+			OnlyDeepest:   settings.OnlyDeepest,
+			LogDepth:      settings.LogDepthColor,
+			Flush:         flushCanvas,
+			SinglePass:    settings.SinglePass,
+			Retain:        settings.RetainGeometry,
+			OriginSegment: settings.DrawOriginSegment,
+			ClosedCurve:   settings.ClosedCurve,
+			Exposure:      settings.Exposure,
+			ExplodeDepth:  settings.FocusDepth,
+			Posterize:     settings.Posterize,
+			Vignette:      settings.Vignette,
+			Frame:         can.Bounds(),
+			HiddenDepths:  settings.HiddenDepths,
+			CapPolicy:     settings.CapPolicy,
+		}
+		if !explodeStart.IsZero() {
+			elapsed := time.Since(explodeStart).Seconds()
+			drawOpts.Explode = settings.ExplodeMagnitude * explodeAmount(elapsed)
+			if elapsed >= explodeTime {
+				explodeStart = time.Time{}
 			}
-			imd.Draw(can)
-			can.Draw(win, canMatrix)
-			can.Clear(pixel.RGBA{R: 0, G: 0, B: 0, A: 255})
 		}
-		if frac.selectedPoint >= 0 {
-			line := frac.Points(1)
+		if settings.FlatColor {
+			drawOpts.Solid = pixel.RGBA{R: 1, G: 1, B: 1, A: 1}
+		}
+		if onion != nil && settings.OnionSkin {
+			ghostOpts := drawOpts
+			ghostOpts.DepthCap = 0
+			ghostOpts.OnlyDeepest = true
+			ghostOpts.Fade = onionFade
+			Draw(can, fracMatrix, onion, ghostOpts)
+		}
+		if settings.PixelSize > 1 {
+			depth := frac.Depth
+			if settings.DepthCap != 0 && settings.DepthCap < depth {
+				depth = settings.DepthCap
+			}
+			DrawPixelArt(can, can.Bounds(), fracMatrix, frac, depth, settings.PixelSize, paletteShift)
+			flushCanvas()
+		} else if settings.StreamDepth > 0 {
+			// the stream depth is drawn on a canvas of its own, which is
+			// kept until something changes, and shown the way can is
+			background := pixel.RGBA{A: 1}
+			if settings.Overlay {
+				background = pixel.RGBA{}
+			}
+			frac.streamCache.Canvas(can.Bounds(), fracMatrix, frac, settings.StreamDepth, drawOpts, background).Draw(linesTarget, linesMatrix)
+		} else {
+			Draw(can, fracMatrix, frac, drawOpts)
+		}
+		if frac.inverseView != nil {
+			inverseOpts := drawOpts
+			inverseOpts.OnlyDeepest = true
+			inverseOpts.Solid = inverseColor
+			Draw(can, fracMatrix, frac.inverseView, inverseOpts)
+		}
+		if settings.ShowVertices && settings.FocusDepth <= frac.Depth {
+			if DrawVertices(can, fracMatrix, frac, settings.FocusDepth, 4, paletteShift) {
+				flushCanvas()
+			}
+		}
+		if settings.ShowCentroid && frac.Depth >= 1 {
+			DrawCentroid(can, fracMatrix, frac, settings.FocusDepth, 16)
+			flushCanvas()
+		}
+		if settings.ShowHull && frac.Depth >= 1 {
+			DrawHull(can, fracMatrix, frac, settings.FocusDepth, 2)
+			flushCanvas()
+		}
+		if frac.trace != nil {
+			DrawAncestors(can, fracMatrix, frac, frac.trace, 12, paletteShift)
+			flushCanvas()
+		}
+		if settings.ShowArrows && settings.FocusDepth <= frac.Depth {
+			if DrawArrows(can, fracMatrix, frac, settings.FocusDepth, 10, paletteShift) {
+				flushCanvas()
+			}
+		}
+		if line := frac.Points(1); frac.selectedPoint >= 0 && frac.selectedPoint < len(line) {
 			p := line[frac.selectedPoint]
+			highlight := func(c int16) pixel.RGBA {
+				if settings.SelectionColor.A != 0 {
+					return settings.SelectionColor
+				}
+				return frac.colorTab[modPlus(c+paletteShift, 1024)]
+			}
 			imd.Clear()
 			if frac.selectedPoint > 0 {
-				imd.Color = frac.colorTab[line[frac.selectedPoint-1].Color]
+				imd.Color = highlight(line[frac.selectedPoint-1].Color)
 				imd.Push(line[frac.selectedPoint-1].Vec)
 			} else {
-				imd.Color = frac.colorTab[line[len(line)-1].Color]
+				imd.Color = highlight(line[len(line)-1].Color)
 				imd.Push(pixel.Vec{})
 			}
-			imd.Color = frac.colorTab[p.Color]
+			imd.Color = highlight(p.Color)
 			imd.Push(p.Vec)
-			imd.Line(6 / fracMatrix[0])
+			imd.Line(settings.SelectionWidth / fracMatrix[0])
+			if snapped {
+				imd.Color = pixel.RGBA{R: 1, G: 1, B: 1, A: 1}
+				imd.Push(p.Vec)
+				imd.Circle(settings.SnapRadius/fracMatrix[0], 2/fracMatrix[0])
+			}
 			imd.Draw(can)
-			can.Draw(win, canMatrix)
-			can.Clear(pixel.RGBA{R: 0, G: 0, B: 0, A: 255})
+			flushCanvas()
+		}
+		frac.updateChanges(dragging)
+		if frac.DrawChanges(can, imd, fracMatrix) {
+			flushCanvas()
+		}
+		if gammaPass {
+			pic := gammaPicture(comp, settings.Gamma)
+			pixel.NewSprite(pic, pic.Bounds()).Draw(win, canMatrix)
+		}
+		if settings.ShowMinimap {
+			win.SetComposeMethod(pixel.ComposeOver)
+			DrawMinimap(win, minimapRect(viewRect), frac, fracRect, paletteShift)
+		}
+		if settings.ShowGrowth {
+			win.SetComposeMethod(pixel.ComposeOver)
+			frac.ShowGrowth(win, pixel.Vec{X: 19, Y: 0})
+		}
+		if gal != nil {
+			win.SetComposeMethod(pixel.ComposeOver)
+			gal.Draw(win)
+		}
+		busy := dragging || zoomT < 1 || settings.AutoRotatePalette || len(replay) > 0 || !explodeStart.IsZero() ||
+			(frac.Depth < frac.MaxDepth-1 && !settings.ManualDepth && heldDepth == 0) ||
+			(frac.Depth < frac.MaxDepth-1 && frac.Depth < heldDepth) ||
+			win.MousePosition() != lastMouse || win.MouseScroll() != (pixel.Vec{}) || win.Typed() != "" ||
+			*settings != lastSettings || frac.generation != lastGeneration
+		if busy {
+			lastActive = now
+		}
+		lastSettings, lastGeneration, lastMouse = *settings, frac.generation, win.MousePosition()
+		runningMutex.Unlock()
+		if *idleAfter > 0 && *idleFPS > 0 && time.Since(lastActive).Seconds() > *idleAfter {
+			// nothing's changing, so wait for input, which wakes us
+			// right away, or the next idle frame
+			win.SwapBuffers()
+			wait := time.Second / time.Duration(*idleFPS)
+			waitStart := time.Now()
+			win.UpdateInputWait(wait)
+			if time.Since(waitStart) < wait {
+				lastActive = time.Now()
+			}
+		} else {
+			win.Update()
+			if frameTick != nil {
+				<-frameTick
+			} else if !*vsync {
+				time.Sleep(time.Millisecond)
+			}
 		}
-		win.Update()
+		runningMutex.Lock()
 		frames++
 		select {
 		case <-second:
@@ -1070,6 +3510,10 @@ func run() {
 			frames = 0
 			totalSeconds++
 			averageFPS = float64(totalFrames) / float64(totalSeconds)
+			saver.Tick(frac)
+			if *statsAddr != "" {
+				updateStats(frac, totalFrames, lastFPS, averageFPS)
+			}
 		default:
 		}
 
@@ -1077,6 +3521,75 @@ func run() {
 	fmt.Printf("Average FPS: %.1f\n", averageFPS)
 }
 
+var (
+	diffMode       = flag.Bool("diff", false, "compare two fractal files (`a.frac b.frac`) and report differences")
+	renderPath     = flag.String("render", "", "render each fractal in `file` (- for standard input), one JSON fractal per line, to a PNG")
+	outDir         = flag.String("out", ".", "write -render images to `dir`")
+	printWidth     = flag.String("width", "", "export images at a physical `width`, such as 200mm or 8in, at -dpi")
+	printDPI       = flag.Float64("dpi", 300, "the resolution, in `N` dots per inch, of exports with -width")
+	geoFit         = flag.Bool("geofit", false, "scale GeoJSON exports to fit longitudes -180 to 180 and latitudes -90 to 90")
+	vsync          = flag.Bool("vsync", true, "sync frames to the monitor refresh")
+	maxFPS         = flag.Int("maxfps", 0, "cap the frame rate at `N` frames per second (0 for no cap)")
+	idleAfter      = flag.Float64("idle", 5, "after `N` seconds of nothing changing, drop to the -idlefps frame rate (0 to stay at full speed)")
+	idleFPS        = flag.Int("idlefps", 10, "the frame rate, in `N` frames per second, when idle")
+	maxBase        = flag.Int("maxbase", MaxBasePoints, "allow up to `N` points in a base")
+	logicalSize    = flag.String("logical", "", "compose the fractal at `WxH` pixels, whatever the window size (default 2000x1600)")
+	preset         = flag.String("preset", "", "start with a generated base, such as `ngon-N` for an N-sided polygon curve")
+	timingsPath    = flag.String("timings", "", "record how long each depth takes to render to `file`, as CSV")
+	statsAddr      = flag.String("stats", "", "serve render statistics as JSON on `addr` (such as :6060), at /debug/vars")
+	loadPath       = flag.String("load", "", "start with the fractal saved in `file` (- for standard input)")
+	targetDepth    = flag.Int("depth", 0, "set MaxOOM to just what rendering to depth `N` needs")
+	prerenderDepth = flag.Int("prerender", -1, "render `N` depths up front, before showing anything (default from settings)")
+	pixelAspect    = flag.Float64("aspect", 0, "stretch the view and exports horizontally by `N`, for non-square pixels (default from settings)")
+	smoothPasses   = flag.Int("smooth", -1, "round off the corners of exported images with `N` passes of corner cutting (default from settings)")
+	streamDepth    = flag.Int("stream", 0, "draw only depth `N`, computed on the fly, which can exceed the usual maximum")
+	recordPath     = flag.String("record", "", "record every edit to `file`, one JSON event per line, for -replay")
+	replayPath     = flag.String("replay", "", "replay the edits recorded in `file` onto the starting fractal")
+	replayLive     = flag.Bool("replaylive", false, "replay edits at the pace they were recorded, rather than all at once")
+	checkLocks     = flag.Bool("checklocks", false, "panic if a fractal is changed while nothing holds the fractal lock (for debugging)")
+	autoSave       = flag.Int("autosave", 60, "autosave to the recovery file every `N` seconds (0 to disable)")
+	// recoveryPath is where autosaves go; an explicit save removes it.
+	recoveryPath = flag.String("recovery", filepath.Join(os.TempDir(), "seebsfrac-recovery.frac"), "autosave to `file`")
+	// paletteSpeed is in color table entries per second; the table has
+	// 1024 entries, so the default goes all the way around in 16 seconds.
+	paletteSpeed = flag.Float64("palettespeed", DefaultSettings().PaletteSpeed, "rotate the palette by `N` colors per second when rotation is on (P)")
+)
+
 func main() {
+	flag.Parse()
+	// whichever mode runs owns the fractals; only the display loop ever
+	// lets go of them, while it waits for a frame
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	if *maxBase >= 2 {
+		MaxBasePoints = *maxBase
+	}
+	// headless modes never touch GL, so they work where it isn't available
+	if *diffMode {
+		if flag.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "usage: %s -diff a.frac b.frac\n", os.Args[0])
+			os.Exit(2)
+		}
+		os.Exit(diffFiles(flag.Arg(0), flag.Arg(1)))
+	}
+	if *renderPath != "" {
+		os.Exit(renderBatch(*renderPath, *outDir))
+	}
+	if err := runWindow(); err != nil {
+		fmt.Fprintf(os.Stderr, "can't open a window: %s\n", err)
+		fmt.Fprintf(os.Stderr, "The editor needs a display and OpenGL 3.3 or later; -diff and -render work without either.\n")
+		os.Exit(1)
+	}
+}
+
+// runWindow runs the interactive editor. pixelgl.Run panics if it can't
+// initialize GLFW at all, so that's turned into an error too.
+func runWindow() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
 	pixelgl.Run(run)
+	return runErr
 }
@@ -0,0 +1,1489 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/faiface/pixel"
+	"golang.org/x/image/font/basicfont"
+)
+
+// testOOM is the point budget for test fractals; it's plenty for the
+// small bases and shallow depths the tests look at.
+const testOOM = 12
+
+// testFractal allocates a fractal with the given base, without the usual
+// chatter, rendered through the prerendered depths.
+func testFractal(t testing.TB, base []Point) *Fractal {
+	t.Helper()
+	f, err := newQuietFractal(base, testOOM)
+	if err != nil {
+		t.Fatalf("new fractal: %s", err)
+	}
+	return f
+}
+
+// tentBase is a two-segment base whose depth 1 and 2 points are easy to
+// work out by hand: depth 1 is a tent up to {0.5, 0.5}, and depth 2 is
+// {0, 0.5}, {0.5, 0.5}, {1, 0.5}, {1, 0}.
+func tentBase() []Point {
+	return []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+		{Vec: pixel.Vec{X: 1}},
+	}
+}
+
+func TestHitSegment(t *testing.T) {
+	f := testFractal(t, tentBase())
+	matrix := pixel.IM.Scaled(pixel.Vec{}, 100)
+	cases := []struct {
+		depth int
+		at    pixel.Vec
+		want  int
+		ok    bool
+	}{
+		{1, pixel.Vec{X: 25, Y: 25}, 0, true},
+		{1, pixel.Vec{X: 75, Y: 25}, 1, true},
+		{1, pixel.Vec{X: 50, Y: 55}, 0, true},
+		{1, pixel.Vec{X: 500, Y: 500}, -1, false},
+		{2, pixel.Vec{X: 2, Y: 25}, 0, true},
+		{2, pixel.Vec{X: 25, Y: 52}, 1, true},
+		{2, pixel.Vec{X: 75, Y: 52}, 2, true},
+		{2, pixel.Vec{X: 98, Y: 25}, 3, true},
+	}
+	for _, c := range cases {
+		got, ok := f.HitSegment(c.at, matrix, c.depth)
+		if got != c.want || ok != c.ok {
+			t.Errorf("depth %d, at %v: got segment %d (%t), want %d (%t)", c.depth, c.at, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestHitSegmentHidden(t *testing.T) {
+	base := tentBase()
+	base[0].Flags = Hide
+	f := testFractal(t, base)
+	matrix := pixel.IM.Scaled(pixel.Vec{}, 100)
+	// the first segment is nearest, but hidden, so the second one is hit
+	got, ok := f.HitSegment(pixel.Vec{X: 45, Y: 45}, matrix, 1)
+	if !ok || got != 1 {
+		t.Errorf("hidden segment: got %d (%t), want 1 (true)", got, ok)
+	}
+}
+
+func TestInverseModes(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.5}, Color: 10},
+		{Vec: pixel.Vec{X: 1}, Color: 20},
+	}
+	cases := []struct {
+		mode int
+		want []pixel.Vec
+	}{
+		// the base, mirrored left to right
+		{InverseReflectX, []pixel.Vec{{X: 0.75, Y: 0.5}, {X: 1}}},
+		// and upside down, which is the base rotated half a turn
+		{InverseReflectXY, []pixel.Vec{{X: 0.75, Y: -0.5}, {X: 1}}},
+		// the same shape, with the colors and flags running backwards
+		{InverseReverse, []pixel.Vec{{X: 0.25, Y: 0.5}, {X: 1}}},
+	}
+	for _, c := range cases {
+		f := testFractal(t, base)
+		f.InverseMode = c.mode
+		f.Changed()
+		for i, p := range f.Inverse {
+			if p.Vec != c.want[i] {
+				t.Errorf("%s: inverse point %d at %v, want %v", inverseModeNames[c.mode], i, p.Vec, c.want[i])
+			}
+		}
+		if f.Inverse[0].Color != 20 || f.Inverse[1].Color != 10 {
+			t.Errorf("%s: inverse colors %d, %d, want 20, 10", inverseModeNames[c.mode], f.Inverse[0].Color, f.Inverse[1].Color)
+		}
+	}
+}
+
+func TestInverseModeRendersFlipX(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.5}, Flags: FlipX},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	f := testFractal(t, base)
+	f.InverseMode = InverseReverse
+	f.Changed()
+	// the FlipX segment is drawn with the inverse, which in this mode
+	// has the base's own shape
+	want := NewAffineBetween(Point{}, f.Points(1)[0]).Project(pixel.Vec{X: 0.25, Y: 0.5})
+	if got := f.Points(2)[0].Vec; got.Sub(want).Len() > 1e-9 {
+		t.Errorf("depth 2 point 0 at %v, want %v", got, want)
+	}
+}
+
+func TestValidateColors(t *testing.T) {
+	f, err := parseFractal([]byte(`{"Base": [{"X": 0.5, "Y": 0.5, "Color": 5000}, {"X": 1, "Color": -1, "Color2": 1024}]}`), "test")
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	if got := f.Base[0].Color; got != 5000%1024 {
+		t.Errorf("color 5000 became %d, want %d", got, 5000%1024)
+	}
+	if got := f.Base[1].Color; got != 1023 {
+		t.Errorf("color -1 became %d, want 1023", got)
+	}
+	if got := f.Base[1].Color2; got != 0 {
+		t.Errorf("color2 1024 became %d, want 0", got)
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	_, err := parseFractal([]byte(`{"Base": [{"X": 0.5, "Y": 0.5}, {"X": 1, "Flags": 4096}]}`), "test")
+	if err == nil {
+		t.Fatalf("unknown flags: expected an error")
+	}
+	if !strings.Contains(err.Error(), "point 2") {
+		t.Errorf("unknown flags: error %q doesn't name point 2", err)
+	}
+	_, err = parseFractal([]byte(`{"Base": [{"X": 1}], "InverseMode": 7}`), "test")
+	if err == nil {
+		t.Errorf("unknown inverse mode: expected an error")
+	}
+}
+
+func TestFlagModes(t *testing.T) {
+	const F = FlipX
+	cases := []struct {
+		mode   int
+		depth2 []int
+		depth3 []int
+	}{
+		// a flip under a flip cancels out
+		{FlagsXor, []int{F, 0, F, 0}, []int{F, 0, F, 0, F, 0, F, 0}},
+		// once flipped, everything below stays flipped
+		{FlagsOr, []int{F, F, F, 0}, []int{F, F, F, F, F, F, F, 0}},
+	}
+	for _, c := range cases {
+		f := testFractal(t, []Point{
+			{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Flags: FlipX},
+			{Vec: pixel.Vec{X: 1}},
+		})
+		f.FlagMode = c.mode
+		f.Changed()
+		for depth, want := range map[int][]int{2: c.depth2, 3: c.depth3} {
+			points := f.Points(depth)
+			if len(points) != len(want) {
+				t.Fatalf("%s: depth %d has %d points, want %d", flagModeNames[c.mode], depth, len(points), len(want))
+			}
+			for i, p := range points {
+				if p.Flags&FlipX != want[i] {
+					t.Errorf("%s: depth %d point %d flags 0x%03x, want 0x%03x", flagModeNames[c.mode], depth, i, p.Flags&FlipX, want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestColorDepthWeight(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 100},
+		{Vec: pixel.Vec{X: 1}, Color: 200},
+	}
+	// depth 1 starts from 0, and depth 2 adds nothing to the base colors,
+	// so depth 3 is the first to show the weight. 400 is enough to take
+	// 200 past what an int16 holds.
+	for _, weight := range []float64{1, 0.5, 2, 400} {
+		f := testFractal(t, base)
+		f.ColorDepthWeight = func(depth int) float64 {
+			if depth == 3 {
+				return weight
+			}
+			return 1
+		}
+		f.Changed()
+		parents := f.Points(2)
+		for i, p := range f.Points(3) {
+			parent := parents[i/len(base)].Color
+			added := int(math.Round(float64(parent) * weight))
+			want := int16((int(base[i%len(base)].Color) + added) % 1024)
+			if p.Color != want {
+				t.Errorf("weight %g: depth 3 point %d color %d, want %d", weight, i, p.Color, want)
+			}
+		}
+	}
+}
+
+func TestFlattenToBase(t *testing.T) {
+	f := testFractal(t, tentBase())
+	if got := f.FlattenDepth(); got != 2 {
+		t.Errorf("flatten depth %d, want 2", got)
+	}
+	if err := f.FlattenToBase(3); err == nil {
+		t.Errorf("flattening 8 points: expected an error")
+	}
+	if len(f.Base) != 2 {
+		t.Fatalf("failed flatten changed the base to %d points", len(f.Base))
+	}
+	want := make([]Point, 4)
+	copy(want, f.Points(2))
+	if err := f.FlattenToBase(2); err != nil {
+		t.Fatalf("flatten: %s", err)
+	}
+	if len(f.Base) != 4 {
+		t.Fatalf("flattened base has %d points, want 4", len(f.Base))
+	}
+	for i := range want {
+		if f.Base[i] != want[i] {
+			t.Errorf("base point %d is %v, want %v", i, f.Base[i], want[i])
+		}
+	}
+	if end := f.Base[3].Vec; end != (pixel.Vec{X: 1}) {
+		t.Errorf("flattened base ends at %v, want {1, 0}", end)
+	}
+	f.Undo()
+	if len(f.Base) != 2 {
+		t.Errorf("undo left %d points, want 2", len(f.Base))
+	}
+	// with the root rotated, the rendered points are too, but the new
+	// base isn't, and it renders the same curve at depth 1
+	f.RootChange(math.Pi/2, 2)
+	copy(want, f.Points(2))
+	if err := f.FlattenToBase(2); err != nil {
+		t.Fatalf("flatten with a rotated root: %s", err)
+	}
+	if end := f.Base[3].Vec; end != (pixel.Vec{X: 1}) {
+		t.Errorf("flattened base with a rotated root ends at %v, want {1, 0}", end)
+	}
+	for i, p := range f.Points(1) {
+		if p.Vec.Sub(want[i].Vec).Len() > 1e-9 {
+			t.Errorf("with a rotated root, depth 1 point %d is at %v, want %v", i, p.Vec, want[i].Vec)
+		}
+	}
+}
+
+func TestUndoModes(t *testing.T) {
+	f := testFractal(t, tentBase())
+	f.InverseModeChange()
+	f.FlagModeChange()
+	f.ColorModeChange()
+	f.Undo()
+	f.Undo()
+	f.Undo()
+	if f.InverseMode != 0 || f.FlagMode != 0 || f.ColorMode != 0 {
+		t.Errorf("after undo, modes are %d, %d, %d, want 0, 0, 0", f.InverseMode, f.FlagMode, f.ColorMode)
+	}
+	// undoing a wrap mode change undoes just that
+	f.InverseModeChange()
+	f.WrapModeChange()
+	f.Undo()
+	if f.WrapMode != WrapAround || f.InverseMode != 1 {
+		t.Errorf("after undoing the wrap mode, wrap mode is %s and inverse mode %d, want Wrap and 1",
+			wrapModeNames[f.WrapMode], f.InverseMode)
+	}
+	f.GlobalFixedColorChange()
+	f.Undo()
+	if f.GlobalFixedColor != FixedPerPoint || f.InverseMode != 1 {
+		t.Errorf("after undoing the global fixed color, it's %s and inverse mode %d, want PerPoint and 1",
+			globalFixedNames[f.GlobalFixedColor], f.InverseMode)
+	}
+}
+
+func TestDepthColor(t *testing.T) {
+	f := &Fractal{MaxDepth: 11}
+	cases := []struct {
+		depth  int
+		linear int16
+		log    int16
+	}{
+		{1, 0, 0},
+		{10, 1023, 1023},
+		{20, 1023, 1023},
+		// linearly, the colors are evenly spaced by depth...
+		{5, int16(math.Round(4.0 / 9 * 1023)), int16(math.Round(math.Log(5) / math.Log(10) * 1023))},
+	}
+	for _, c := range cases {
+		if got := f.DepthColor(c.depth, false); got != c.linear {
+			t.Errorf("linear depth %d: color %d, want %d", c.depth, got, c.linear)
+		}
+		if got := f.DepthColor(c.depth, true); got != c.log {
+			t.Errorf("log depth %d: color %d, want %d", c.depth, got, c.log)
+		}
+	}
+	// ...but logarithmically, the shallow depths get more of it
+	if lin, log := f.DepthColor(2, false), f.DepthColor(2, true); log <= lin {
+		t.Errorf("depth 2: log color %d isn't past linear color %d", log, lin)
+	}
+}
+
+func TestDiverging(t *testing.T) {
+	// each segment is about twice as long as the one it replaces, so
+	// every depth is about twice as big
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 2}},
+		{Vec: pixel.Vec{X: 1}},
+	})
+	if f.Depth < 4 {
+		t.Fatalf("only rendered to depth %d", f.Depth)
+	}
+	if !f.Diverging() {
+		t.Errorf("expanding base: not diverging, sizes %v", f.sizes[:f.Depth+1])
+	}
+	f = testFractal(t, tentBase())
+	if f.Diverging() {
+		t.Errorf("shrinking base: diverging, sizes %v", f.sizes[:f.Depth+1])
+	}
+}
+
+func TestAnchorColors(t *testing.T) {
+	cases := []struct {
+		colors [4]int16
+		fixed  [4]bool
+		want   [4]int16
+	}{
+		{[4]int16{100, 0, 0, 400}, [4]bool{true, false, false, true}, [4]int16{100, 200, 300, 400}},
+		// the short way round the color table is through 0
+		{[4]int16{1000, 0, 0, 100}, [4]bool{true, false, false, true}, [4]int16{1000, 17, 59, 100}},
+		// outside the anchors, points take the nearest one's color
+		{[4]int16{0, 300, 0, 0}, [4]bool{false, true, false, false}, [4]int16{300, 300, 300, 300}},
+		// with no anchors, everything keeps its own color
+		{[4]int16{1, 2, 3, 4}, [4]bool{}, [4]int16{1, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		base := make([]Point, 4)
+		for i := range base {
+			base[i] = Point{Vec: pixel.Vec{X: float64(i+1) / 4}, Color: c.colors[i]}
+			if c.fixed[i] {
+				base[i].Flags = FixedC
+			}
+		}
+		f := testFractal(t, base)
+		f.ColorMode = ColorAnchorInterp
+		f.Changed()
+		for i, got := range f.AnchorColors() {
+			if got != c.want[i] {
+				t.Errorf("%v: point %d color %d, want %d", c.colors, i, got, c.want[i])
+			}
+			if d1 := f.Points(1)[i].Color; d1 != c.want[i] {
+				t.Errorf("%v: depth 1 point %d color %d, want %d", c.colors, i, d1, c.want[i])
+			}
+		}
+	}
+}
+
+func TestRenderStream(t *testing.T) {
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.3, Y: 0.3}, Color: 100, Flags: FlipX},
+		{Vec: pixel.Vec{X: 0.7, Y: -0.3}, Color: 200, Flags: Prune},
+		{Vec: pixel.Vec{X: 1}, Color: 300},
+	})
+	var streamed []Point
+	f.RenderStream(4, func(p Point) {
+		streamed = append(streamed, p)
+	})
+	rendered := f.Points(4)
+	if len(streamed) != len(rendered) {
+		t.Fatalf("streamed %d points, rendered %d", len(streamed), len(rendered))
+	}
+	for i := range rendered {
+		if streamed[i] != rendered[i] {
+			t.Errorf("point %d: streamed %v, rendered %v", i, streamed[i], rendered[i])
+		}
+	}
+}
+
+// BenchmarkRenderStream streams depth 20, a million points, which Render
+// would need about 64MB for; the stream needs well under a megabyte.
+func BenchmarkRenderStream(b *testing.B) {
+	f := testFractal(b, tentBase())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		f.RenderStream(20, func(Point) { n++ })
+		if n != 1<<20 {
+			b.Fatalf("streamed %d points, want %d", n, 1<<20)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	f := testFractal(t, tentBase())
+	if got := f.NonFinite(); got != -1 {
+		t.Errorf("finite base: NonFinite is %d, want -1", got)
+	}
+	f.Base[0].X = math.NaN()
+	f.Changed()
+	if got := f.NonFinite(); got != 0 {
+		t.Errorf("NaN base: NonFinite is %d, want 0", got)
+	}
+	if f.Render(1) {
+		t.Errorf("NaN base: depth 1 rendered")
+	}
+	if f.renderErr == nil || !strings.Contains(f.renderErr.Error(), "point 1") {
+		t.Errorf("NaN base: error %v doesn't name point 1", f.renderErr)
+	}
+	if !finite(f.Bounds.Min) || !finite(f.Bounds.Max) {
+		t.Errorf("NaN base: bounds %v aren't finite", f.Bounds)
+	}
+	f.Base[0].X = math.Inf(1)
+	f.Changed()
+	if got := f.NonFinite(); got != 0 {
+		t.Errorf("infinite base: NonFinite is %d, want 0", got)
+	}
+	f.Base[0].X = 0.5
+	f.Changed()
+	if f.renderErr != nil || f.Depth < 1 {
+		t.Errorf("fixed base: error %v, depth %d", f.renderErr, f.Depth)
+	}
+}
+
+func TestPointsZero(t *testing.T) {
+	f := testFractal(t, tentBase())
+	points := f.Points(0)
+	if len(points) != 1 {
+		t.Fatalf("depth 0 has %d points, want 1", len(points))
+	}
+	if points[0] != f.data[0] || points[0] != f.lines[0][0] {
+		t.Errorf("depth 0 is %v, but the stored point is %v", points[0], f.data[0])
+	}
+	if points[0] != f.Root {
+		t.Errorf("depth 0 is %v, want the root, %v", points[0], f.Root)
+	}
+	// moving the root moves depth 0 with it
+	f.RootChange(math.Pi/2, 2)
+	if got := f.Points(0)[0]; got != f.data[0] || got.Vec.Sub(pixel.Vec{Y: 2}).Len() > 1e-9 {
+		t.Errorf("rotated root: depth 0 is %v, stored %v", got, f.data[0])
+	}
+}
+
+func TestSelectByFlag(t *testing.T) {
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.2, Y: 0.2}, Flags: FlipX},
+		{Vec: pixel.Vec{X: 0.4, Y: 0.2}, Flags: FlipY | Hide},
+		{Vec: pixel.Vec{X: 0.6, Y: 0.2}, Flags: FlipX | FlipY},
+		{Vec: pixel.Vec{X: 0.8, Y: 0.2}},
+		{Vec: pixel.Vec{X: 1}, Flags: FixedC},
+	})
+	cases := []struct {
+		flag int
+		want []int
+	}{
+		{FlipX, []int{0, 2}},
+		{FlipY, []int{1, 2}},
+		{Hide, []int{1}},
+		{FixedC, []int{4}},
+		{Prune, nil},
+	}
+	for _, c := range cases {
+		got := f.SelectByFlag(c.flag)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("flag 0x%03x: got %v, want %v", c.flag, got, c.want)
+		}
+	}
+	// bulk operations apply to the whole selection
+	f.SelectPoints(f.SelectByFlag(FlipX))
+	f.XChange(0.05)
+	if f.Base[0].X != 0.25 || f.Base[2].X != 0.65 || f.Base[1].X != 0.4 {
+		t.Errorf("moving the FlipX points: base is %v", f.Base)
+	}
+}
+
+func TestColorPinned(t *testing.T) {
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.3, Y: 0.3}, Color: 100},
+		{Vec: pixel.Vec{X: 0.7, Y: -0.3}, Color: 400},
+		{Vec: pixel.Vec{X: 1}, Color: 700, Flags: FlipX},
+	})
+	f.ColorMode = ColorPinned
+	f.Changed()
+	for depth := 1; depth <= f.Depth; depth++ {
+		colors := map[int16]bool{}
+		for _, p := range f.Points(depth) {
+			colors[p.Color] = true
+		}
+		if len(colors) != 3 || !colors[100] || !colors[400] || !colors[700] {
+			t.Errorf("depth %d: colors %v, want 100, 400, 700", depth, colors)
+		}
+	}
+}
+
+func TestMergePoint(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.25}, Color: 1},
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 2},
+		{Vec: pixel.Vec{X: 0.75, Y: 0.25}, Color: 3, Flags: FlipX},
+		{Vec: pixel.Vec{X: 1}, Color: 4},
+	}
+	f := testFractal(t, base)
+	f.SelectPoint(2)
+	f.MergePoint()
+	if len(f.Base) != 3 {
+		t.Fatalf("merged base has %d points, want 3", len(f.Base))
+	}
+	want := Point{Vec: pixel.Vec{X: 0.625, Y: 0.375}, Color: 3, Flags: FlipX}
+	if f.Base[1] != want {
+		t.Errorf("merged point is %v, want %v", f.Base[1], want)
+	}
+	if f.selectedPoint != 1 {
+		t.Errorf("selected point %d, want 1", f.selectedPoint)
+	}
+	// merging the last point leaves the end of the curve where it is
+	f.SelectPoint(2)
+	f.MergePoint()
+	if len(f.Base) != 2 || f.Base[1].Vec != (pixel.Vec{X: 1}) {
+		t.Errorf("merging the last point: base is %v", f.Base)
+	}
+	// and two points is as few as there can be
+	f.SelectPoint(1)
+	f.MergePoint()
+	if len(f.Base) != 2 {
+		t.Errorf("merged a two point base down to %d", len(f.Base))
+	}
+	f.Undo()
+	f.Undo()
+	if !reflect.DeepEqual(f.Base, base) {
+		t.Errorf("undo: base is %v, want %v", f.Base, base)
+	}
+}
+
+func TestClonePoint(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 10, Flags: FlipY},
+		{Vec: pixel.Vec{X: 1}, Color: 20},
+	}
+	f := testFractal(t, base)
+	f.SelectPoint(1)
+	f.ClonePoint()
+	if len(f.Base) != 3 {
+		t.Fatalf("cloned base has %d points, want 3", len(f.Base))
+	}
+	// the clone goes before the original, so the end doesn't move
+	want := Point{Vec: pixel.Vec{X: 1}.Add(cloneOffset), Color: 20}
+	if f.Base[1] != want || f.Base[2] != base[1] {
+		t.Errorf("cloned base is %v, want clone %v before %v", f.Base, want, base[1])
+	}
+	if f.selectedPoint != 1 {
+		t.Errorf("selected point %d, want the clone, 1", f.selectedPoint)
+	}
+	f.SelectPoint(0)
+	f.ClonePoint()
+	if f.Base[0].Flags != FlipY || f.Base[0].Color != 10 || f.Base[1] != base[0] {
+		t.Errorf("cloning the first point: base is %v", f.Base)
+	}
+	// the base can't grow past MaxBasePoints
+	for i := 0; i < MaxBasePoints; i++ {
+		f.ClonePoint()
+	}
+	if len(f.Base) != MaxBasePoints {
+		t.Errorf("cloned up to %d points, max is %d", len(f.Base), MaxBasePoints)
+	}
+	f.Undo()
+	if len(f.Base) != MaxBasePoints-1 {
+		t.Errorf("undo: %d points, want %d", len(f.Base), MaxBasePoints-1)
+	}
+}
+
+func TestCoincidentPoints(t *testing.T) {
+	cases := []struct {
+		base []Point
+		want [][2]int
+	}{
+		{tentBase(), nil},
+		// the first point on the origin collapses the first segment
+		{[]Point{{}, {Vec: pixel.Vec{X: 1}}}, [][2]int{{-1, 0}}},
+		{[]Point{
+			{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+			{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+			{Vec: pixel.Vec{X: 1}},
+		}, [][2]int{{0, 1}}},
+		// points in the same place, but not consecutive, are fine
+		{[]Point{
+			{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+			{Vec: pixel.Vec{X: 0.5}},
+			{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+			{Vec: pixel.Vec{X: 1}},
+		}, nil},
+	}
+	for i, c := range cases {
+		f := &Fractal{Base: c.base}
+		if got := f.CoincidentPoints(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: coincident points %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestLinearColor(t *testing.T) {
+	f := testFractal(t, tentBase())
+	defer func() {
+		// the color table is shared, so put it back
+		f.Settings.LinearColor = false
+		f.fillColorTab()
+	}()
+	// entry 86 is hue 30, halfway from red to yellow
+	const mid = 86
+	plain := f.colorTab[mid]
+	if math.Abs(plain.G-127.0/255) > 1e-9 {
+		t.Fatalf("plain midpoint green %g, want %g", plain.G, 127.0/255)
+	}
+	f.LinearColorChange()
+	linear := f.colorTab[mid]
+	if math.Abs(linear.R-1) > 1e-9 || linear.B != 0 {
+		t.Errorf("linear midpoint %v: red and blue should be unchanged", linear)
+	}
+	if want := srgbEncode(plain.G); math.Abs(linear.G-want) > 1e-9 || linear.G <= plain.G {
+		t.Errorf("linear midpoint green %g, want %g, brighter than %g", linear.G, want, plain.G)
+	}
+	// the primaries are the same either way
+	if red := f.colorTab[0]; math.Abs(red.R-1) > 1e-9 || red.G != 0 || red.B != 0 {
+		t.Errorf("linear red is %v", f.colorTab[0])
+	}
+}
+
+func TestColorFreezeDepth(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 100},
+		{Vec: pixel.Vec{X: 1}, Color: 100},
+	}
+	for _, c := range []struct {
+		freeze int
+		want   [4]int16 // the color at depths 1 to 3
+	}{
+		// depth 1 starts at 0, and each depth adds the base's 100
+		{-1, [4]int16{0, 0, 100, 200}},
+		{1, [4]int16{0, 0, 0, 0}},
+		{2, [4]int16{0, 0, 100, 100}},
+	} {
+		f := testFractal(t, base)
+		f.Settings.ColorFreezeDepth = c.freeze
+		f.Changed()
+		for depth := 1; depth <= 3; depth++ {
+			if !f.Render(depth) {
+				t.Fatalf("freeze %d: can't render depth %d", c.freeze, depth)
+			}
+			for i, p := range f.Points(depth) {
+				if p.Color != c.want[depth] {
+					t.Errorf("freeze %d: depth %d point %d color %d, want %d",
+						c.freeze, depth, i, p.Color, c.want[depth])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestBookmarkTowards(t *testing.T) {
+	from := Bookmark{Scale: 0, Pan: pixel.Vec{X: -1, Y: 2}, DepthCap: 3}
+	to := Bookmark{Scale: 10, Pan: pixel.Vec{X: 1, Y: 4}, DepthCap: 6}
+	if got := from.towards(to, 0); got.Scale != from.Scale || got.Pan != from.Pan {
+		t.Errorf("at 0: %v, want %v", got, from)
+	}
+	if got := from.towards(to, 1); got != to {
+		t.Errorf("at 1: %v, want %v", got, to)
+	}
+	want := Bookmark{Scale: 5, Pan: pixel.Vec{X: 0, Y: 3}, DepthCap: 6}
+	if got := from.towards(to, 0.5); got != want {
+		t.Errorf("halfway: %v, want %v", got, want)
+	}
+	// the pan moves the view by exactly that much
+	f := testFractal(t, tentBase())
+	port := pixel.R(0, 0, 100, 100)
+	still := f.AdjustedBounds(port, 4, pixel.Vec{})
+	moved := f.AdjustedBounds(port, 4, want.Pan)
+	if moved != still.Moved(want.Pan) {
+		t.Errorf("panned view %v, want %v moved by %v", moved, still, want.Pan)
+	}
+}
+
+func TestMaxOOMRange(t *testing.T) {
+	for _, oom := range []uint{0, minMaxOOM - 1, maxMaxOOM + 1, 40} {
+		if f, err := NewFractal(tentBase(), oom); err == nil || f != nil {
+			t.Errorf("MaxOOM %d: got a fractal, and error %v", oom, err)
+		}
+	}
+	// a file can't ask for an absurd budget either
+	if _, err := parseFractal([]byte(`{"MaxOOM": 40, "Base": [{"X": 1}]}`), "absurd"); err == nil {
+		t.Errorf("loading MaxOOM 40 should fail")
+	}
+	// but one which doesn't say gets the budget it had
+	saved, err := parseFractal([]byte(`{"Base": [{"X": 1}]}`), "unsaid")
+	if err != nil || saved.MaxOOM != 0 {
+		t.Errorf("loading without MaxOOM: MaxOOM %d, error %v", saved.MaxOOM, err)
+	}
+	f := testFractal(t, tentBase())
+	path := filepath.Join(t.TempDir(), "oom.frac")
+	if err := writeSaved(path, []byte(`{"MaxOOM": 10, "Base": [{"X": 1}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.LoadFrom(path); err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if f.MaxOOM != 10 || len(f.data) != 1<<10 {
+		t.Errorf("loaded MaxOOM %d with %d points, want 10 and %d", f.MaxOOM, len(f.data), 1<<10)
+	}
+	// the keys stop at the ends of the range, so what's saved can be
+	// loaded; setting MaxOOM directly skips allocating that many points
+	f.MaxOOM = maxMaxOOM
+	f.MaxOOMChange(1)
+	if f.MaxOOM != maxMaxOOM {
+		t.Errorf("stepping past the maximum: MaxOOM %d, want %d", f.MaxOOM, maxMaxOOM)
+	}
+	f.MaxOOM = minMaxOOM
+	f.MaxOOMChange(-1)
+	if f.MaxOOM != minMaxOOM {
+		t.Errorf("stepping past the minimum: MaxOOM %d, want %d", f.MaxOOM, minMaxOOM)
+	}
+}
+
+func TestRootChangeUndo(t *testing.T) {
+	f := testFractal(t, tentBase())
+	f.RootChange(math.Pi/2, 2)
+	// the root goes from {1, 0} to {0, 2}, so the tent's peak, {0.5, 0.5},
+	// goes to {-1, 1}
+	if got := f.Root.Vec; math.Abs(got.X) > 1e-9 || math.Abs(got.Y-2) > 1e-9 {
+		t.Errorf("rotated root is %v, want {0, 2}", got)
+	}
+	f.Render(1)
+	if got := f.Points(1)[0].Vec; math.Abs(got.X+1) > 1e-9 || math.Abs(got.Y-1) > 1e-9 {
+		t.Errorf("rotated peak is %v, want {-1, 1}", got)
+	}
+	f.Undo()
+	if f.Root != defaultRoot {
+		t.Errorf("after undo, root is %v, want %v", f.Root, defaultRoot)
+	}
+	f.Changed()
+	f.Render(1)
+	if got := f.Points(1)[0].Vec; got != (pixel.Vec{X: 0.5, Y: 0.5}) {
+		t.Errorf("after undo, peak is %v, want {0.5, 0.5}", got)
+	}
+}
+
+func TestSubdivideAll(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 10, Flags: FlipX},
+		{Vec: pixel.Vec{X: 1}, Color: 20},
+	}
+	f := testFractal(t, base)
+	f.SelectPoint(1)
+	f.SubdivideAll()
+	want := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.25}, Color: 10, Flags: FlipX},
+		base[0],
+		{Vec: pixel.Vec{X: 0.75, Y: 0.25}, Color: 20},
+		base[1],
+	}
+	if !reflect.DeepEqual(f.Base, want) {
+		t.Errorf("subdivided base is %v, want %v", f.Base, want)
+	}
+	if f.selectedPoint != 3 {
+		t.Errorf("selected point is %d, want the same point, now 3", f.selectedPoint)
+	}
+	// once it wouldn't fit, it does nothing at all
+	for len(f.Base)*2 <= MaxBasePoints {
+		f.SubdivideAll()
+	}
+	n := len(f.Base)
+	f.SubdivideAll()
+	if len(f.Base) != n {
+		t.Errorf("subdividing %d points past the maximum of %d gave %d", n, MaxBasePoints, len(f.Base))
+	}
+	for len(f.undo) > 1 {
+		f.Undo()
+	}
+	f.Undo()
+	if !reflect.DeepEqual(f.Base, base) {
+		t.Errorf("after undoing, base is %v, want %v", f.Base, base)
+	}
+}
+
+func TestHitPointZoom(t *testing.T) {
+	f := testFractal(t, tentBase())
+	// the peak is point 0, at {0.5, 0.5}; clicks are offset from it in
+	// canvas pixels, so they should hit or miss the same way at any zoom
+	for _, zoom := range []float64{100, 1000, 10000} {
+		matrix := pixel.IM.Scaled(pixel.Vec{}, zoom)
+		peak := matrix.Project(pixel.Vec{X: 0.5, Y: 0.5})
+		if got := f.HitPoint(peak.Add(pixel.Vec{X: 10}), matrix, pickRadius); got != 0 {
+			t.Errorf("zoom %g: 10 pixels off hit %d, want 0", zoom, got)
+		}
+		if got := f.HitPoint(peak.Add(pixel.Vec{X: 100}), matrix, pickRadius); got != -1 {
+			t.Errorf("zoom %g: 100 pixels off hit %d, want nothing", zoom, got)
+		}
+	}
+	// past the radius, the nearest point is only picked if it's clearly
+	// the nearest: zoomed in, it is, but zoomed out, the other point is
+	// almost as close
+	cases := []struct {
+		zoom float64
+		want int
+	}{
+		{10000, 0},
+		{10, -1},
+	}
+	for _, c := range cases {
+		matrix := pixel.IM.Scaled(pixel.Vec{}, c.zoom)
+		peak := matrix.Project(pixel.Vec{X: 0.5, Y: 0.5})
+		if got := f.HitPoint(peak.Add(pixel.Vec{X: 40}), matrix, pickRadius); got != c.want {
+			t.Errorf("zoom %g: 40 pixels off hit %d, want %d", c.zoom, got, c.want)
+		}
+	}
+}
+
+func TestTallBaseBounds(t *testing.T) {
+	// the base reaches far above the unit segment, and the bounds should
+	// too, as soon as depth 1 is rendered
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 3}},
+		{Vec: pixel.Vec{X: 1}},
+	})
+	// Changed prerenders deeper depths; start over with just depth 0
+	f.Changed()
+	f.Depth, f.Bounds = 0, f.rootBounds()
+	if !f.Render(1) {
+		t.Fatalf("render depth 1: %v", f.renderErr)
+	}
+	if f.Bounds.Max.Y < 3 {
+		t.Errorf("bounds after depth 1 are %v, which don't reach the peak at 3", f.Bounds)
+	}
+}
+
+func TestMaxOOMForDepth(t *testing.T) {
+	cases := []struct {
+		baseLen, depth int
+		want           uint
+	}{
+		{2, 3, 4},   // 1+2+4+8 = 15 points
+		{2, 10, 11}, // 2047 points
+		{3, 5, 9},   // 364 points
+		{4, 40, maxMaxOOM + 1},
+	}
+	for _, c := range cases {
+		if got := MaxOOMForDepth(c.baseLen, c.depth); got != c.want {
+			t.Errorf("%d points to depth %d: MaxOOM %d, want %d", c.baseLen, c.depth, got, c.want)
+		}
+	}
+	f := testFractal(t, tentBase())
+	f.DepthChange(10)
+	if f.MaxOOM != 11 || f.MaxDepth <= 10 {
+		t.Errorf("after DepthChange(10), MaxOOM %d and MaxDepth %d, want 11 and past 10", f.MaxOOM, f.MaxDepth)
+	}
+	// shallow depths still get the minimum
+	f.DepthChange(1)
+	if f.MaxOOM != minMaxOOM {
+		t.Errorf("after DepthChange(1), MaxOOM %d, want %d", f.MaxOOM, minMaxOOM)
+	}
+}
+
+func TestMirrorPairs(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.5}},
+		{Vec: pixel.Vec{X: 0.5, Y: 0.25}},
+		{Vec: pixel.Vec{X: 0.75, Y: 0.5}},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	f := testFractal(t, base)
+	// ctrl-clicking a point twice doesn't select it twice
+	f.SelectPoints([]int{2, 0, 2})
+	if got := f.selection(); !reflect.DeepEqual(got, []int{2, 0}) {
+		t.Errorf("selecting 2, 0, 2 selected %v, want [2 0]", got)
+	}
+	// a point can't be its own partner
+	f.multiSelect = []int{1, 1}
+	f.MirrorChange()
+	if len(f.mirror) != 0 {
+		t.Errorf("pairing point 1 with itself made pairs %v", f.mirror)
+	}
+	f.SelectPoints([]int{0, 2})
+	f.MirrorChange()
+	if f.mirror[0] != 2 || f.mirror[2] != 0 {
+		t.Fatalf("pairing 0 and 2 made pairs %v", f.mirror)
+	}
+	// replacing the base, even with one the same length, drops the pairs
+	f.Undo()
+	if f.mirror != nil {
+		t.Errorf("after undo, pairs are %v, want none", f.mirror)
+	}
+	f.SelectPoints([]int{0, 2})
+	f.MirrorChange()
+	f.StashReference()
+	f.SwapReference()
+	if f.mirror != nil {
+		t.Errorf("after swapping in the reference, pairs are %v, want none", f.mirror)
+	}
+}
+
+func TestLoadFaceFallback(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.ttf")
+	if err := writeSaved(garbage, []byte("not a font")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing.ttf"), garbage} {
+		if _, err := loadTTF(path, 18); err == nil {
+			t.Errorf("%s: loading it should fail", path)
+		}
+		face := loadFace(path, 18)
+		if face != basicfont.Face7x13 {
+			t.Errorf("%s: didn't fall back to the built-in face", path)
+		}
+		if _, ok := face.GlyphAdvance('A'); !ok {
+			t.Errorf("%s: the fallback face has no glyph for A", path)
+		}
+	}
+	if face := loadFace("Go-Mono.ttf", 18); face == basicfont.Face7x13 {
+		t.Errorf("Go-Mono.ttf didn't load")
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	f := testFractal(t, tentBase())
+	cases := []struct {
+		depth int
+		want  []pixel.Vec
+	}{
+		// the origin starts the curve, so it's in the hull
+		{0, []pixel.Vec{{}, {X: 1}}},
+		{1, []pixel.Vec{{}, {X: 1}, {X: 0.5, Y: 0.5}}},
+		// {0.5, 0.5} is on the top edge, so it's left out
+		{2, []pixel.Vec{{}, {X: 1}, {X: 1, Y: 0.5}, {X: 0, Y: 0.5}}},
+	}
+	for _, c := range cases {
+		got := f.ConvexHull(c.depth)
+		same := len(got) == len(c.want)
+		for i := 0; same && i < len(got); i++ {
+			same = got[i].Sub(c.want[i]).Len() < 1e-9
+		}
+		if !same {
+			t.Errorf("depth %d: hull %v, want %v", c.depth, got, c.want)
+		}
+	}
+	// past what's rendered, it's the deepest depth that is
+	if got, want := f.ConvexHull(f.Depth+5), f.ConvexHull(f.Depth); !reflect.DeepEqual(got, want) {
+		t.Errorf("past depth %d: hull %v, want %v", f.Depth, got, want)
+	}
+	// a flat base's hull is just the ends
+	flat := testFractal(t, []Point{{Vec: pixel.Vec{X: 0.5}}, {Vec: pixel.Vec{X: 1}}})
+	if got, want := flat.ConvexHull(1), []pixel.Vec{{}, {X: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flat base: hull %v, want %v", got, want)
+	}
+}
+
+func TestFlipYOutput(t *testing.T) {
+	f := testFractal(t, tentBase())
+	port := pixel.R(0, 0, 100, 100)
+	rect := pixel.R(0, -0.5, 1, 0.5)
+	peak := pixel.Vec{X: 0.5, Y: 0.5}
+	for _, flip := range []bool{false, true} {
+		f.Settings.FlipYOutput = flip
+		// the view: Y goes up on screen, so the peak is at the top,
+		// unless it's flipped
+		want := 100.0
+		if flip {
+			want = 0
+		}
+		if got := f.viewMatrix(rect, port).Project(peak).Y; got != want {
+			t.Errorf("flip %t: view has the peak at Y %g, want %g", flip, got, want)
+		}
+		// SVG: Y goes down, so it's negated, unless it's flipped
+		if got := f.svgY(0.5); (got == 0.5) != flip || math.Abs(got) != 0.5 {
+			t.Errorf("flip %t: SVG Y of 0.5 is %g", flip, got)
+		}
+		// images: Y goes down too, so the peak is in the top half of the
+		// image, unless it's flipped
+		img, err := f.rasterize(1, 100, 100, 1, 0)
+		if err != nil {
+			t.Fatalf("rasterize: %s", err)
+		}
+		top := -1
+		for y := 0; y < img.h && top < 0; y++ {
+			if img.at(50, y) >= 0 {
+				top = y
+			}
+		}
+		if top < 0 || (top < 50) == flip {
+			t.Errorf("flip %t: the peak is drawn at row %d", flip, top)
+		}
+	}
+}
+
+func TestChangedSegments(t *testing.T) {
+	before := []Point{
+		{Vec: pixel.Vec{X: 0.25}},
+		{Vec: pixel.Vec{X: 0.5}},
+		{Vec: pixel.Vec{X: 0.75}},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	after := append([]Point(nil), before...)
+	if got := ChangedSegments(before, after, 0.01); len(got) != 0 {
+		t.Errorf("nothing moved, but segments %v changed", got)
+	}
+	// moving point 1 changes the segments on both sides of it
+	after[1].Y = 0.1
+	if got, want := ChangedSegments(before, after, 0.01), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moving point 1 changed segments %v, want %v", got, want)
+	}
+	// but not by more than the threshold
+	if got := ChangedSegments(before, after, 0.2); len(got) != 0 {
+		t.Errorf("moving point 1 less than the threshold changed segments %v", got)
+	}
+	// the first segment starts at the origin, which doesn't move
+	after = append([]Point(nil), before...)
+	after[0].Y = 0.1
+	if got, want := ChangedSegments(before, after, 0.01), []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("moving point 0 changed segments %v, want %v", got, want)
+	}
+	// points which can't be matched up all count
+	if got, want := ChangedSegments(before, before[:2], 0.01), []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dropping points changed segments %v, want %v", got, want)
+	}
+}
+
+func TestRenderFailure(t *testing.T) {
+	f := testFractal(t, tentBase())
+	maxDepth := f.MaxDepth
+	// a NaN base can't render, so prerendering stops at depth 0, and caps
+	// MaxDepth there, so nothing tries to go deeper
+	f.Base[1].Y = math.NaN()
+	f.Changed()
+	if f.renderErr == nil {
+		t.Errorf("NaN base: no render error")
+	}
+	if f.Depth != 0 || f.MaxDepth != 1 {
+		t.Errorf("NaN base: depth %d, MaxDepth %d, want 0 and 1", f.Depth, f.MaxDepth)
+	}
+	// fixing it lifts the cap
+	f.Base[1].Y = 0
+	f.Changed()
+	if f.renderErr != nil || f.MaxDepth != maxDepth || f.Depth < 1 {
+		t.Errorf("fixed base: error %v, depth %d, MaxDepth %d, want %d",
+			f.renderErr, f.Depth, f.MaxDepth, maxDepth)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	session, err := openSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := testFractal(t, tentBase())
+	f.session = session
+	f.SelectPoint(0)
+	f.XChange(0.1)
+	f.ColorChange(50)
+	f.Toggle(FlipX)
+	f.AddPointAt(0.5)
+	f.SelectPoints([]int{1, 2})
+	f.YChange(-0.2)
+	f.SubdivideAll()
+	f.SelectPoint(3)
+	f.ClonePoint()
+	f.DelPoint()
+	// the undo has to undo the root change, not the delete before it
+	f.RootChange(-0.2, 0.9)
+	f.Undo()
+	f.RootChange(0.3, 1.1)
+	f.SelectPoint(2)
+	f.SetColorAbsolute(700)
+	f.Undo()
+	f.SelectPoint(1)
+	f.Color2Change(20)
+	f.session = nil
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events, err := ReadSession(path)
+	if err != nil {
+		t.Fatalf("read session: %s", err)
+	}
+	g := testFractal(t, tentBase())
+	if err := g.Replay(events); err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+	if !reflect.DeepEqual(g.Base, f.Base) {
+		t.Errorf("replayed base is\n%v\nwant\n%v", g.Base, f.Base)
+	}
+	if g.Root != f.Root {
+		t.Errorf("replayed root is %v, want %v", g.Root, f.Root)
+	}
+}
+
+func TestWrapColor(t *testing.T) {
+	cases := []struct {
+		mode int
+		in   int
+		want int16
+	}{
+		{WrapAround, 1000, 1000},
+		{WrapAround, 1100, 76},
+		{WrapAround, 2100, 52},
+		{WrapAround, -10, 1014},
+		{WrapClamp, 1100, 1023},
+		{WrapClamp, 40000, 1023},
+		{WrapClamp, -10, 0},
+		{WrapPingPong, 1023, 1023},
+		{WrapPingPong, 1100, 946},
+		{WrapPingPong, 2046, 0},
+		{WrapPingPong, 2100, 54},
+		{WrapPingPong, -10, 10},
+	}
+	for _, c := range cases {
+		f := &Fractal{WrapMode: c.mode}
+		if got := f.wrapColor(c.in); got != c.want {
+			t.Errorf("%s: wrapColor(%d) = %d, want %d", wrapModeNames[c.mode], c.in, got, c.want)
+		}
+	}
+	// depth 3 of a base which adds 600 a depth gets to 1200, past the
+	// end of the table
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 600},
+		{Vec: pixel.Vec{X: 1}, Color: 600},
+	}
+	for mode, want := range map[int]int16{WrapAround: 176, WrapClamp: 1023, WrapPingPong: 846} {
+		f := testFractal(t, base)
+		f.WrapMode = mode
+		f.Changed()
+		if got := f.Points(3)[0].Color; got != want {
+			t.Errorf("%s: depth 3 color %d, want %d", wrapModeNames[mode], got, want)
+		}
+	}
+}
+
+func TestSwapReference(t *testing.T) {
+	f := testFractal(t, tentBase())
+	original := append([]Point(nil), f.Base...)
+	f.StashReference()
+	f.SelectPoint(0)
+	f.YChange(0.25)
+	edited := append([]Point(nil), f.Base...)
+	f.SwapReference()
+	if !reflect.DeepEqual(f.Base, original) || !f.referenceOn {
+		t.Errorf("swapped in: base %v, on %t, want the reference %v", f.Base, f.referenceOn, original)
+	}
+	// stashing now would lose the working base, so it doesn't
+	f.StashReference()
+	f.SwapReference()
+	if !reflect.DeepEqual(f.Base, edited) || f.referenceOn {
+		t.Errorf("toggled twice: base %v, on %t, want the original %v", f.Base, f.referenceOn, edited)
+	}
+	// undoing the swaps gets back to the same places
+	f.Undo()
+	if !reflect.DeepEqual(f.Base, original) || !f.referenceOn {
+		t.Errorf("undoing a swap: base %v, on %t, want %v", f.Base, f.referenceOn, original)
+	}
+	f.Undo()
+	if !reflect.DeepEqual(f.Base, edited) || f.referenceOn {
+		t.Errorf("undoing both swaps: base %v, on %t, want %v", f.Base, f.referenceOn, edited)
+	}
+	if !reflect.DeepEqual(f.reference, original) {
+		t.Errorf("after undoing, the reference is %v, want %v", f.reference, original)
+	}
+}
+
+func TestOnscreen(t *testing.T) {
+	port := pixel.R(0, 0, 100, 100)
+	matrix := pixel.IM.Scaled(pixel.Vec{}, 100)
+	flipped := pixel.IM.ScaledXY(pixel.Vec{}, pixel.Vec{X: 100, Y: -100}).Moved(pixel.Vec{Y: 100})
+	nan := pixel.IM.Scaled(pixel.Vec{}, math.NaN())
+	cases := []struct {
+		name   string
+		rect   pixel.Rect
+		matrix pixel.Matrix
+		want   bool
+	}{
+		{"inside", pixel.R(0.2, 0.2, 0.8, 0.8), matrix, true},
+		{"around", pixel.R(-1, -1, 2, 2), matrix, true},
+		{"overlapping a corner", pixel.R(0.9, 0.9, 1.5, 1.5), matrix, true},
+		{"touching an edge", pixel.R(1, 0, 2, 1), matrix, true},
+		{"off to the right", pixel.R(1.1, 0, 2, 1), matrix, false},
+		{"below", pixel.R(0, -2, 1, -0.1), matrix, false},
+		{"flipped inside", pixel.R(0.2, 0.2, 0.8, 0.8), flipped, true},
+		{"flipped below", pixel.R(0, 1.1, 1, 2), flipped, false},
+		{"not a number", pixel.R(0.2, 0.2, 0.8, 0.8), nan, false},
+	}
+	for _, c := range cases {
+		if got := onscreen(c.rect, c.matrix, port); got != c.want {
+			t.Errorf("%s: onscreen is %t, want %t", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMirrorBase(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.2, Y: 0.3}},
+		{Vec: pixel.Vec{X: 0.3, Y: 0.6}, Flags: FlipY},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	f := testFractal(t, base)
+	// an axis left of the origin would mirror the curve backwards
+	f.Base[0].X = -0.2
+	if err := f.MirrorBase(0); err == nil {
+		t.Errorf("mirroring around X=-0.2 didn't fail")
+	}
+	f.Base[0].X = 0.2
+	// the axis is at X=0.3, so the curve ends at {0.6, 0}, and is scaled
+	// up to end at {1, 0}
+	if err := f.MirrorBase(1); err != nil {
+		t.Fatalf("mirror base: %v", err)
+	}
+	if len(f.Base) != 4 {
+		t.Fatalf("mirroring around point 1 made %d points, want 4", len(f.Base))
+	}
+	last := f.Base[len(f.Base)-1].Vec
+	if math.Abs(last.X-1) > 1e-9 || math.Abs(last.Y) > 1e-9 {
+		t.Errorf("mirrored base ends at %v, want {1, 0}", last)
+	}
+	// every point other than the end is the reflection of another one, or
+	// the origin, across X=0.5
+	for i := 0; i < len(f.Base)-1; i++ {
+		var other pixel.Vec
+		if j := len(f.Base) - 2 - i; j >= 0 {
+			other = f.Base[j].Vec
+		}
+		p := f.Base[i].Vec
+		if math.Abs(p.X+other.X-1) > 1e-9 || math.Abs(p.Y-other.Y) > 1e-9 {
+			t.Errorf("point %d at %v doesn't mirror %v", i, p, other)
+		}
+	}
+	// the segment mirroring point 1's has FlipX toggled, and keeps FlipY
+	if got := f.Base[2].Flags; got != FlipX|FlipY {
+		t.Errorf("mirrored segment has flags %v, want FlipX|FlipY", got)
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	f := testFractal(t, tentBase())
+	// both segments are the same length, so the centroid is halfway
+	// between their midpoints, which is also the center of the bounds
+	if got := f.Centroid(1); got.Sub(pixel.Vec{X: 0.5, Y: 0.25}).Len() > 1e-9 {
+		t.Errorf("centroid of the tent is %v, want {0.5, 0.25}", got)
+	}
+	if got := f.Balance(1); got > 1e-9 {
+		t.Errorf("balance of the tent is %g, want 0", got)
+	}
+	// the tent is symmetric around X=0.5, and so is every depth of it
+	for depth := 2; depth <= f.Depth; depth++ {
+		if got := f.Centroid(depth); math.Abs(got.X-0.5) > 1e-9 {
+			t.Errorf("depth %d: centroid at %v, want X=0.5", depth, got)
+		}
+	}
+	// hidden segments don't count
+	f.Base[1].Flags |= Hide
+	f.Alloc()
+	if got := f.Centroid(1); got.Sub(pixel.Vec{X: 0.25, Y: 0.25}).Len() > 1e-9 {
+		t.Errorf("centroid with the second segment hidden is %v, want {0.25, 0.25}", got)
+	}
+}
+
+func TestDashedSubtree(t *testing.T) {
+	f := testFractal(t, tentBase())
+	dest := make([]Point, len(f.Base))
+	f.Partial(2, Point{}, Point{Vec: pixel.Vec{X: 1}, Flags: Dashed}, dest)
+	for i, p := range dest {
+		if p.Flags&Dashed == 0 {
+			t.Errorf("point %d under a dashed segment isn't dashed", i)
+		}
+	}
+	f.Partial(2, Point{}, Point{Vec: pixel.Vec{X: 1}}, dest)
+	for i, p := range dest {
+		if p.Flags&Dashed != 0 {
+			t.Errorf("point %d under a plain segment is dashed", i)
+		}
+	}
+	// dashing the first segment of the base dashes the whole first half
+	// of every depth; the copies of it in the second half are dashed too,
+	// but the last segment, which only ever descends from plain ones, isn't
+	f.Base[0].Flags |= Dashed
+	f.Alloc()
+	for depth := 2; depth <= f.Depth; depth++ {
+		points := f.Points(depth)
+		for i, p := range points[:len(points)/2] {
+			if p.Flags&Dashed == 0 {
+				t.Errorf("depth %d: point %d of %d isn't dashed", depth, i, len(points))
+				break
+			}
+		}
+		if points[len(points)-1].Flags&Dashed != 0 {
+			t.Errorf("depth %d: last point is dashed", depth)
+		}
+	}
+	if f.Depth < 2 {
+		t.Errorf("only rendered to depth %d", f.Depth)
+	}
+}
+
+// TestWithFractals renders on one goroutine while another reads the
+// bounds, both through withFractals, with -checklocks on. Run it with
+// -race to check that withFractals actually keeps them apart.
+func TestWithFractals(t *testing.T) {
+	f := testFractal(t, tentBase())
+	*checkLocks = true
+	defer func() { *checkLocks = false }()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			withFractals(func() {
+				f.Base[0].Y = 0.25 + float64(i%10)/20
+				f.Changed()
+				for depth := 1; depth <= 6; depth++ {
+					f.Render(depth)
+				}
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			withFractals(func() {
+				if r := f.BoundsAt(f.Depth); r.W() < 1 {
+					t.Errorf("depth %d bounds %v narrower than the base", f.Depth, r)
+				}
+			})
+		}
+	}()
+	wg.Wait()
+}
+
+func TestAncestorChain(t *testing.T) {
+	f := testFractal(t, tentBase())
+	// with two base points, each depth doubles, so segment 5 (binary 101)
+	// at depth 3 comes from 2 at depth 2 and 1 at depth 1
+	if got := f.ancestorIndices(3, 5); !reflect.DeepEqual(got, []int{0, 1, 2, 5}) {
+		t.Errorf("ancestors of segment 5 at depth 3: got %v, want [0 1 2 5]", got)
+	}
+	chain := f.AncestorChain(3, 5)
+	if len(chain) != 4 {
+		t.Fatalf("chain for segment 5 at depth 3 has %d segments, want 4", len(chain))
+	}
+	if chain[0] != f.Root || chain[3] != f.Points(3)[5] {
+		t.Errorf("chain runs from %v to %v, want the root %v to %v", chain[0], chain[3], f.Root, f.Points(3)[5])
+	}
+	if got := f.AncestorChain(3, len(f.Points(3))); got != nil {
+		t.Errorf("chain for a segment past the end: got %v, want nil", got)
+	}
+	// a pruned segment is copied as it is, so it has one child
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.25}},
+		{Vec: pixel.Vec{X: 0.75, Y: 0.25}, Flags: Prune},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	f = testFractal(t, base)
+	want := []int{0, 0, 0, 1, 2, 2, 2}
+	if n := len(f.Points(2)); n != len(want) {
+		t.Fatalf("depth 2 has %d segments, want %d", n, len(want))
+	}
+	for i := range want {
+		if got := f.parentIndex(2, i); got != want[i] {
+			t.Errorf("parent of segment %d at depth 2: got %d, want %d", i, got, want[i])
+		}
+	}
+}
+
+func TestGlobalFixedColor(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 100, Flags: FixedC},
+		{Vec: pixel.Vec{X: 1}, Color: 200},
+	}
+	f := testFractal(t, base)
+	parent := Point{Vec: pixel.Vec{X: 1}, Color: 300}
+	dest := make([]Point, len(base))
+	for _, c := range []struct {
+		mode int
+		want [2]int16
+	}{
+		// the FixedC point keeps its color, the other adds the parent's
+		{FixedPerPoint, [2]int16{100, 500}},
+		{FixedAll, [2]int16{100, 200}},
+		{FixedNone, [2]int16{400, 500}},
+	} {
+		if f.GlobalFixedColor != c.mode {
+			t.Fatalf("modes out of order: at %s, want %s",
+				globalFixedNames[f.GlobalFixedColor], globalFixedNames[c.mode])
+		}
+		f.Partial(2, Point{}, parent, dest)
+		if got := [2]int16{dest[0].Color, dest[1].Color}; got != c.want {
+			t.Errorf("%s: colors %v, want %v", globalFixedNames[c.mode], got, c.want)
+		}
+		f.GlobalFixedColorChange()
+	}
+	if f.GlobalFixedColor != FixedPerPoint {
+		t.Errorf("cycling through the modes ended at %s", globalFixedNames[f.GlobalFixedColor])
+	}
+}
+
+// TestRenderTimings checks that every render of the fractal being edited,
+// including the prerendering after an edit, is in the timing log as soon
+// as it happens, and that quiet fractals' renders aren't.
+func TestRenderTimings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.csv")
+	log, err := openTimings(path)
+	if err != nil {
+		t.Fatalf("open timings: %v", err)
+	}
+	renderTimings = log
+	defer func() {
+		renderTimings = nil
+		log.Close()
+	}()
+	quiet := testFractal(t, tentBase())
+	f := testFractal(t, tentBase())
+	f.quiet = false
+	f.Changed()
+	quiet.Changed()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read timings: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(rows) != f.Depth+1 {
+		t.Fatalf("got %d rows after prerendering to depth %d, want a header and one per depth:\n%s", len(rows), f.Depth, data)
+	}
+	for depth := 1; depth <= f.Depth; depth++ {
+		if want := fmt.Sprintf("%d,%d,", depth, len(f.Points(depth))); !strings.HasPrefix(rows[depth], want) {
+			t.Errorf("row %d is %q, want it to start %q", depth, rows[depth], want)
+		}
+	}
+}
+
+// TestMirrorPairEdits pairs two points of a symmetric base, edits one, and
+// checks that the fractal stays symmetric.
+func TestMirrorPairEdits(t *testing.T) {
+	half := []Point{
+		{Vec: pixel.Vec{X: 0.25, Y: 0.5}},
+		{Vec: pixel.Vec{X: 0.5, Y: 0.25}},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	f := testFractal(t, half)
+	if err := f.MirrorBase(1); err != nil {
+		t.Fatalf("mirror base: %v", err)
+	}
+	// point 0 reflects point 2, and the segment ending at 0, from the
+	// origin, reflects the one ending at 3
+	f.SelectPoints([]int{0, 2})
+	f.MirrorChange()
+	f.SelectPoint(0)
+	f.Toggle(FlipY)
+	f.ColorChange(100)
+	if got, want := f.Base[3].Flags, f.Base[0].Flags^FlipX; got != want {
+		t.Errorf("reflected segment has flags %v, want %v", got, want)
+	}
+	if got, want := f.Base[3].Color, f.Base[0].Color; got != want {
+		t.Errorf("reflected segment has color %d, want %d", got, want)
+	}
+	for f.Depth < 3 {
+		f.Render(f.Depth + 1)
+	}
+	points := f.Points(3)
+	for i := 0; i < len(points)-1; i++ {
+		var other pixel.Vec
+		if j := len(points) - 2 - i; j >= 0 {
+			other = points[j].Vec
+		}
+		p := points[i].Vec
+		if math.Abs(p.X+other.X-1) > 1e-9 || math.Abs(p.Y-other.Y) > 1e-9 {
+			t.Fatalf("depth 3: point %d at %v doesn't mirror %v", i, p, other)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// minimapPoints is the most points the minimap draws; it uses the deepest
+// rendered depth that fits, so it stays cheap however deep the main view
+// goes.
+const minimapPoints = 4096
+
+// minimapSize is the size of the minimap, in window pixels, and
+// minimapMargin is how far it is from the corner of the view.
+var (
+	minimapSize   = pixel.Vec{X: 200, Y: 160}
+	minimapMargin = 10.0
+)
+
+// minimapIMD is reused from frame to frame.
+var minimapIMD *imdraw.IMDraw
+
+// minimapRect yields where the minimap goes, in the bottom right corner of
+// the view.
+func minimapRect(view pixel.Rect) pixel.Rect {
+	max := pixel.Vec{X: view.Max.X - minimapMargin, Y: view.Min.Y + minimapMargin + minimapSize.Y}
+	return pixel.Rect{Min: max.Sub(minimapSize), Max: max}
+}
+
+// minimapDepth yields the deepest rendered depth with few enough points
+// for the minimap.
+func (f *Fractal) minimapDepth() int {
+	depth := 1
+	for depth < f.Depth && len(f.Points(depth+1)) <= minimapPoints {
+		depth++
+	}
+	return depth
+}
+
+// DrawMinimap draws the whole fractal, at a shallow depth, into rect, with
+// an outline around the part of it the main view shows, which is view, in
+// fractal coordinates. Hidden segments are left out, but it doesn't bother
+// with gradients or the other drawing options.
+func DrawMinimap(target pixel.Target, rect pixel.Rect, frac *Fractal, view pixel.Rect, shift int16) {
+	if minimapIMD == nil {
+		minimapIMD = imdraw.New(nil)
+	}
+	imd := minimapIMD
+	imd.SetMatrix(pixel.IM)
+	imd.Clear()
+	imd.Color = pixel.RGBA{A: 0.8}
+	imd.Push(rect.Min, rect.Max)
+	imd.Rectangle(0)
+	imd.Color = pixel.RGBA{R: 0.5, G: 0.5, B: 0.5, A: 1}
+	imd.Push(rect.Min, rect.Max)
+	imd.Rectangle(1)
+	imd.Draw(target)
+
+	matrix := frac.viewMatrix(frac.AdjustedBounds(rect, 0, pixel.Vec{}), rect)
+	imd.Clear()
+	imd.SetMatrix(matrix)
+	depth := frac.minimapDepth()
+	byDepth := frac.ColorMode == ColorByDepth
+	color := func(c int16) pixel.RGBA {
+		if byDepth {
+			c = frac.DepthColor(depth, false)
+		}
+		return frac.colorTab[modPlus(c+shift, 1024)]
+	}
+	width := 1 / matrix[0]
+	prev := pixel.Vec{}
+	drawing := false
+	for _, p := range frac.Points(depth) {
+		if p.Flags&Hide != 0 {
+			if drawing {
+				imd.Line(width)
+				drawing = false
+			}
+			prev = p.Vec
+			continue
+		}
+		if !drawing {
+			imd.Color = color(p.Color)
+			imd.Push(prev)
+			drawing = true
+		}
+		imd.Color = color(p.Color)
+		imd.Push(p.Vec)
+		prev = p.Vec
+	}
+	if drawing {
+		imd.Line(width)
+	}
+	imd.Draw(target)
+
+	// the view's outline, in window coordinates so it can be clipped
+	// to the minimap when the view is bigger than the whole fractal
+	outline := pixel.Rect{Min: matrix.Project(view.Min), Max: matrix.Project(view.Max)}.Norm()
+	outline = outline.Intersect(rect)
+	imd.Clear()
+	imd.SetMatrix(pixel.IM)
+	imd.Color = pixel.RGBA{R: 1, G: 1, B: 1, A: 1}
+	imd.Push(outline.Min, outline.Max)
+	imd.Rectangle(1)
+	imd.Draw(target)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// maxPixelSize is the chunkiest pixel art mode gets; past that, there's not
+// much fractal left to see.
+const maxPixelSize = 32
+
+// pixelSizeStep doubles or halves the pixel size, going back to 1, which
+// is off, past maxPixelSize, and around to maxPixelSize below 2.
+func pixelSizeStep(n int, up bool) int {
+	switch {
+	case up && n*2 > maxPixelSize:
+		return 1
+	case up:
+		return n * 2
+	case n <= 1:
+		return maxPixelSize
+	default:
+		return n / 2
+	}
+}
+
+// upscale scales img up by size, nearest neighbor, to w by h. Pixels past
+// the edge of the scaled image repeat the last row or column.
+func upscale(img *image.NRGBA, size, w, h int) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := y / size
+		if sy >= b.Dy() {
+			sy = b.Dy() - 1
+		}
+		for x := 0; x < w; x++ {
+			sx := x / size
+			if sx >= b.Dx() {
+				sx = b.Dx() - 1
+			}
+			out.SetNRGBA(x, y, img.NRGBAAt(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// RenderPixelArt renders the given depth as a w by h image of chunky
+// pixels, each size by size. It's rasterized at the low resolution, with
+// one pixel lines and no supersampling, so every pixel is exactly one
+// color from the palette, then scaled up.
+func (f *Fractal) RenderPixelArt(depth, w, h, size int) (*image.NRGBA, error) {
+	if size < 1 || size > maxPixelSize {
+		return nil, fmt.Errorf("pixel art: pixel size must be 1 to %d, not %d", maxPixelSize, size)
+	}
+	lw, lh := (w+size-1)/size, (h+size-1)/size
+	if lw <= 2*rasterMargin || lh <= 2*rasterMargin {
+		return nil, fmt.Errorf("pixel art: %dx%d is too small for %d pixel pixels", w, h, size)
+	}
+	small, err := f.rasterize(depth, lw, lh, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return upscale(f.colorize(small, lw, lh, 1, 0, true), size, w, h), nil
+}
+
+// pixelArtView is the low resolution rendering pixel art mode shows, which
+// is kept until the fractal, the view, or the pixel size changes, since
+// rasterizing it is slow compared to drawing it.
+type pixelArtView struct {
+	generation uint64
+	matrix     pixel.Matrix
+	depth      int
+	size       int
+	img        *indexImage
+}
+
+// DrawPixelArt draws the given depth into target, which covers frame, at
+// size times less resolution, scaled back up. matrix is the usual view
+// matrix, so the fractal sits where Draw would put it, fitted by
+// AdjustedBounds. The target shouldn't be smoothed, so the pixels scale up
+// nearest neighbor and stay sharp.
+func DrawPixelArt(target pixel.Target, frame pixel.Rect, matrix pixel.Matrix, frac *Fractal, depth, size int, shift int16) {
+	if depth < 1 || depth > frac.Depth {
+		return
+	}
+	lw := int(math.Ceil(frame.W() / float64(size)))
+	lh := int(math.Ceil(frame.H() / float64(size)))
+	v := &frac.pixelArt
+	if v.img == nil || v.generation != frac.generation || v.matrix != matrix || v.depth != depth || v.size != size {
+		low := matrix.Chained(pixel.IM.Moved(frame.Min.Scaled(-1)).Scaled(pixel.Vec{}, 1/float64(size)))
+		// images count Y down
+		project := func(p pixel.Vec) pixel.Vec {
+			p = low.Project(p)
+			return pixel.Vec{X: p.X, Y: float64(lh) - p.Y}
+		}
+		v.img = newIndexImage(lw, lh)
+		v.img.drawPoints(frac.Points(depth), project, 1, frac.Settings.DrawOriginSegment, frac.Settings.ClosedCurve)
+		v.generation, v.matrix, v.depth, v.size = frac.generation, matrix, depth, size
+	}
+	pic := pixel.PictureDataFromImage(frac.colorize(v.img, lw, lh, 1, shift, true))
+	sprite := pixel.NewSprite(pic, pic.Bounds())
+	at := pixel.IM.Scaled(pixel.Vec{}, float64(size)).Moved(frame.Min.Add(pic.Bounds().Center().Scaled(float64(size))))
+	sprite.Draw(target, at)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// PolygonBase yields a base for an N-gon curve, the generalization of the
+// Koch curve: the middle third of the segment is replaced by the other N-1
+// sides of a regular N-gon standing on it, so a triangle gives the Koch
+// curve and a square gives the quadratic Koch curve. The polygon goes on
+// the positive Y side. It has N+1 points, and returns nil if N < 3.
+func PolygonBase(n int) []Point {
+	if n < 3 {
+		return nil
+	}
+	const side = 1.0 / 3
+	// the polygon's vertices, counterclockwise from the start of the
+	// middle third; the curve visits them clockwise, the long way round.
+	verts := make([]pixel.Vec, n)
+	verts[0] = pixel.Vec{X: side}
+	for i := 1; i < n; i++ {
+		angle := 2 * math.Pi * float64(i-1) / float64(n)
+		verts[i] = verts[i-1].Add(pixel.V(side, 0).Rotated(angle))
+	}
+	base := make([]Point, 0, n+1)
+	base = append(base, Point{Vec: verts[0]})
+	for i := n - 1; i >= 1; i-- {
+		base = append(base, Point{Vec: verts[i]})
+	}
+	base = append(base, Point{Vec: pixel.Vec{X: 1}})
+	for i := range base {
+		base[i].Color = int16(i * 128 % 1024)
+	}
+	return base
+}
+
+// presetBase yields the base for a named preset, such as "ngon-5".
+func presetBase(name string) ([]Point, error) {
+	var n int
+	if _, err := fmt.Sscanf(name, "ngon-%d", &n); err != nil {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+	base := PolygonBase(n)
+	if base == nil {
+		return nil, fmt.Errorf("preset %q: need at least 3 sides", name)
+	}
+	if len(base) > MaxBasePoints {
+		return nil, fmt.Errorf("preset %q: needs %d points, max is %d (see -maxbase)", name, len(base), MaxBasePoints)
+	}
+	return base, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestPolygonBase(t *testing.T) {
+	near := func(a, b pixel.Vec) bool {
+		return a.Sub(b).Len() < 1e-9
+	}
+	for n := 3; n <= 8; n++ {
+		base := PolygonBase(n)
+		if len(base) != n+1 {
+			t.Errorf("%d-gon: %d points, want %d", n, len(base), n+1)
+			continue
+		}
+		// the polygon stands on the middle third, and the curve ends
+		// at the end of the unit segment
+		if !near(base[0].Vec, pixel.Vec{X: 1.0 / 3}) || !near(base[n-1].Vec, pixel.Vec{X: 2.0 / 3}) {
+			t.Errorf("%d-gon: middle third runs from %v to %v", n, base[0].Vec, base[n-1].Vec)
+		}
+		if base[n].Vec != (pixel.Vec{X: 1}) {
+			t.Errorf("%d-gon: ends at %v, want {1, 0}", n, base[n].Vec)
+		}
+		// every side of the polygon is a third long, and above the line
+		prev := base[0].Vec
+		for _, p := range base[1:n] {
+			if l := p.Vec.Sub(prev).Len(); math.Abs(l-1.0/3) > 1e-9 {
+				t.Errorf("%d-gon: side to %v is %g long", n, p.Vec, l)
+			}
+			if p.Vec.Y < -1e-9 {
+				t.Errorf("%d-gon: %v is below the line", n, p.Vec)
+			}
+			prev = p.Vec
+		}
+	}
+	// a triangle is the Koch curve
+	if apex := PolygonBase(3)[1].Vec; !near(apex, pixel.Vec{X: 0.5, Y: math.Sqrt(3) / 6}) {
+		t.Errorf("triangle: apex at %v", apex)
+	}
+	if PolygonBase(2) != nil {
+		t.Errorf("2-gon: expected nil")
+	}
+}
+
+func TestPresetBase(t *testing.T) {
+	if base, err := presetBase("ngon-4"); err != nil || len(base) != 5 {
+		t.Errorf("ngon-4: %d points, error %v", len(base), err)
+	}
+	for _, name := range []string{"ngon-2", "ngon-9", "square"} {
+		if _, err := presetBase(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/faiface/pixel"
+)
+
+// maxExportPixels is the most pixels an export at a physical size can
+// have, before supersampling; a typo in the width or DPI shouldn't try to
+// allocate gigabytes.
+const maxExportPixels = 1 << 26
+
+// mmPerInch is the number of millimeters in an inch.
+const mmPerInch = 25.4
+
+// lengthUnits are the units parseLength understands, in millimeters.
+var lengthUnits = map[string]float64{
+	"mm": 1,
+	"cm": 10,
+	"in": mmPerInch,
+}
+
+// parseLength parses a physical length, such as 200mm or 8in, yielding
+// millimeters. A bare number is in millimeters.
+func parseLength(s string) (float64, error) {
+	number, unit := s, "mm"
+	for u := range lengthUnits {
+		if strings.HasSuffix(s, u) {
+			number, unit = strings.TrimSuffix(s, u), u
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || !(n > 0) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("length %q should be a positive number of mm, cm, or in", s)
+	}
+	return n * lengthUnits[unit], nil
+}
+
+// PrintSize is a physical size to export at: a width in millimeters, the
+// height following from the aspect ratio, and a resolution. A zero width
+// means no physical size.
+type PrintSize struct {
+	WidthMM float64
+	DPI     float64
+}
+
+// Pixels yields the size, in pixels, of an image with the given aspect
+// ratio at the print size, scaled down if need be to fit maxExportPixels.
+func (p PrintSize) Pixels(aspect pixel.Vec) (w, h int) {
+	fw := p.WidthMM / mmPerInch * p.DPI
+	fh := fw * aspect.Y / aspect.X
+	if fw*fh > maxExportPixels {
+		shrink := math.Sqrt(maxExportPixels / (fw * fh))
+		fmt.Printf("export: %.0fx%.0f is too big, using %.0fx%.0f\n", fw, fh, fw*shrink, fh*shrink)
+		fw, fh = fw*shrink, fh*shrink
+	}
+	return int(math.Max(1, math.Round(fw))), int(math.Max(1, math.Round(fh)))
+}
+
+// printSize yields the print size from the -width and -dpi flags.
+func printSize() (PrintSize, error) {
+	if *printWidth == "" {
+		return PrintSize{}, nil
+	}
+	mm, err := parseLength(*printWidth)
+	if err != nil {
+		return PrintSize{}, err
+	}
+	if !(*printDPI > 0) {
+		return PrintSize{}, errors.New("dpi should be positive")
+	}
+	return PrintSize{WidthMM: mm, DPI: *printDPI}, nil
+}
+
+// writePNGDPI writes an image to the named file as a PNG, recording the
+// resolution in a pHYs chunk, which image/png doesn't write, so it's
+// spliced in after the header. A dpi of 0 writes a plain PNG.
+func writePNGDPI(path string, img image.Image, dpi float64) error {
+	if dpi == 0 {
+		return writePNG(path, img)
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+	// the 8-byte signature, then IHDR: length, type, 13 bytes, CRC
+	headerEnd := 8 + 4 + 4 + 13 + 4
+	if len(encoded) < headerEnd {
+		return errors.New("png: encoding too short")
+	}
+	perMeter := uint32(math.Round(dpi / mmPerInch * 1000))
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], perMeter)
+	binary.BigEndian.PutUint32(chunk[12:], perMeter)
+	chunk[16] = 1 // the unit is meters
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	for _, part := range [][]byte{encoded[:headerEnd], chunk, encoded[headerEnd:]} {
+		if _, err = file.Write(part); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
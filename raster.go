@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// rasterMargin is the border, in pixels, left around software renderings.
+const rasterMargin = 8
+
+// indexImage is a software rendering of one depth, which holds color table
+// indices rather than colors, so the palette can be applied, or rotated,
+// afterwards. Pixels where nothing was drawn are -1.
+type indexImage struct {
+	w, h int
+	pix  []int16
+	// wrap makes lines which go off one edge come back on the opposite
+	// one, so the image tiles.
+	wrap bool
+}
+
+// at yields the color index at x, y, counting y from the top.
+func (img *indexImage) at(x, y int) int16 {
+	return img.pix[y*img.w+x]
+}
+
+// rasterize renders the given depth, which is rendered first if it hasn't
+// been, into a w by h index image, fitted to the depth's bounds. Lines are
+// lineWidth pixels wide, and colors are interpolated along each segment
+// the way Draw does it, except that it's the indices that are interpolated.
+// The curve is smoothed with smoothPasses of chaikin first.
+func (f *Fractal) rasterize(depth, w, h, lineWidth, smoothPasses int) (*indexImage, error) {
+	if depth < 1 {
+		return nil, fmt.Errorf("rasterize: depth %d too shallow", depth)
+	}
+	for f.Depth < depth {
+		if !f.Render(f.Depth + 1) {
+			return nil, fmt.Errorf("rasterize: can't render depth %d", f.Depth+1)
+		}
+	}
+	img := newIndexImage(w, h)
+	points := chaikin(f.Points(depth), smoothPasses)
+	bounds := f.BoundsAt(depth)
+	// fit the bounds to the image, keeping the aspect ratio
+	margin := rasterMargin * lineWidth
+	stretch := f.Settings.aspectScale()
+	scale := math.Min(float64(w-2*margin)/math.Max(bounds.W()*stretch.X, 1e-9),
+		float64(h-2*margin)/math.Max(bounds.H()*stretch.Y, 1e-9))
+	center := bounds.Center()
+	// images count Y down, so Y is negated, unless the output is flipped
+	ySign := -1.0
+	if f.Settings.FlipYOutput {
+		ySign = 1
+	}
+	project := func(v pixel.Vec) pixel.Vec {
+		v = v.Sub(center).Scaled(scale)
+		return pixel.Vec{X: float64(w)/2 + v.X*stretch.X, Y: float64(h)/2 + ySign*v.Y*stretch.Y}
+	}
+	img.drawPoints(points, project, lineWidth, f.Settings.DrawOriginSegment, f.Settings.ClosedCurve)
+	return img, nil
+}
+
+// newIndexImage yields a w by h index image with nothing drawn in it.
+func newIndexImage(w, h int) *indexImage {
+	img := &indexImage{w: w, h: h, pix: make([]int16, w*h)}
+	for i := range img.pix {
+		img.pix[i] = -1
+	}
+	return img
+}
+
+// drawPoints draws the lines of a depth, with project mapping them onto
+// the image, lineWidth pixels wide. The segment from the origin to the
+// first point is only drawn if origin is set, as with OriginSegment in
+// Draw. If closed is set, it blends from the last point's color, as though
+// the curve wrapped around, the way Draw does with ClosedCurve; otherwise
+// it's the first point's color.
+func (img *indexImage) drawPoints(points []Point, project func(pixel.Vec) pixel.Vec, lineWidth int, origin, closed bool) {
+	if len(points) == 0 {
+		return
+	}
+	prev := Point{Color: points[0].Color}
+	if closed {
+		prev.Color = points[len(points)-1].EndColor()
+	}
+	dashAt := 0.0
+	for i, p := range points {
+		if i == 0 && !origin {
+			prev = p
+			continue
+		}
+		c0, c1 := prev.EndColor(), p.Color
+		if p.Flags&HasColor2 != 0 {
+			c0, c1 = p.Color, p.Color2
+		}
+		a, b := project(prev.Vec), project(p.Vec)
+		switch {
+		case p.Flags&Hide != 0:
+			dashAt = 0
+		case p.Flags&Dashed != 0:
+			dashSpans(b.Sub(a).Len(), dashPixels*float64(lineWidth), &dashAt, func(t0, t1 float64) {
+				img.line(pixel.Lerp(a, b, t0), pixel.Lerp(a, b, t1), lerpColor(c0, c1, t0), lerpColor(c0, c1, t1), lineWidth)
+			})
+		default:
+			img.line(a, b, c0, c1, lineWidth)
+			dashAt = 0
+		}
+		prev = p
+	}
+}
+
+// line draws a line from a to b, width pixels wide, interpolating the
+// color index.
+func (img *indexImage) line(a, b pixel.Vec, ca, cb int16, width int) {
+	steps := int(math.Ceil(math.Max(math.Abs(b.X-a.X), math.Abs(b.Y-a.Y))))
+	if steps < 1 {
+		steps = 1
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		v := pixel.Lerp(a, b, t)
+		c := modPlus(int16(math.Round(float64(ca)+(float64(cb)-float64(ca))*t)), 1024)
+		x0, y0 := int(math.Floor(v.X))-width/2, int(math.Floor(v.Y))-width/2
+		for y := y0; y < y0+width; y++ {
+			for x := x0; x < x0+width; x++ {
+				switch {
+				case img.wrap:
+					wx, wy := (x%img.w+img.w)%img.w, (y%img.h+img.h)%img.h
+					img.pix[wy*img.w+wx] = c
+				case x >= 0 && y >= 0 && x < img.w && y < img.h:
+					img.pix[y*img.w+x] = c
+				}
+			}
+		}
+	}
+}
+
+// RenderToImage renders the given depth as a w by h image, on black. It's
+// drawn at ssaa times the size, with lines ssaa pixels wide, then scaled
+// down by averaging each ssaa by ssaa block of pixels, which smooths the
+// edges; 1 means no supersampling. smoothPasses rounds off the corners;
+// see chaikin.
+func (f *Fractal) RenderToImage(depth, w, h, ssaa, smoothPasses int) (*image.NRGBA, error) {
+	if ssaa < 1 || ssaa > maxSSAA {
+		return nil, fmt.Errorf("render: supersampling must be 1 to %d, not %d", maxSSAA, ssaa)
+	}
+	big, err := f.rasterize(depth, w*ssaa, h*ssaa, ssaa, smoothPasses)
+	if err != nil {
+		return nil, err
+	}
+	return f.colorize(big, w, h, ssaa, 0, true), nil
+}
+
+// colorize turns an index image ssaa times the size into a w by h image,
+// on black, averaging each ssaa by ssaa block of pixels, with the palette
+// shifted by shift, and vignetted if vignetted is set.
+func (f *Fractal) colorize(big *indexImage, w, h, ssaa int, shift int16, vignetted bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	samples := ssaa * ssaa
+	frame := pixel.R(0, 0, float64(w), float64(h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b float64
+			for sy := 0; sy < ssaa; sy++ {
+				for sx := 0; sx < ssaa; sx++ {
+					if c := big.at(x*ssaa+sx, y*ssaa+sy); c >= 0 {
+						tc := f.colorTab[modPlus(c+shift, 1024)]
+						r, g, b = r+tc.R, g+tc.G, b+tc.B
+					}
+				}
+			}
+			// the vignette is in image coordinates, so y being flipped
+			// doesn't matter
+			v := 1.0
+			if vignetted {
+				v = vignette(f.Settings.Vignette, pixel.Vec{X: float64(x) + 0.5, Y: float64(y) + 0.5}, frame)
+			}
+			v /= float64(samples)
+			c := gammaCorrect(pixel.RGBA{R: r * v, G: g * v, B: b * v, A: 1}, f.Settings.Gamma)
+			img.SetNRGBA(x, y, toNRGBA(c))
+		}
+	}
+	return img
+}
+
+// maxSSAA is the largest supersampling factor RenderToImage allows.
+const maxSSAA = 4
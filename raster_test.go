@@ -0,0 +1,293 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// TestClosedCurveExport exports depth 1 of a two-color tent as a PNG, with
+// and without ClosedCurve, and checks the color where it starts, at the
+// origin, which is the last point's color only if the curve is closed.
+func TestClosedCurveExport(t *testing.T) {
+	base := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 100, Flags: FixedC},
+		{Vec: pixel.Vec{X: 1}, Color: 600, Flags: FixedC},
+	}
+	// depth 1 runs from {0, 0} to {1, 0}, up to 0.5 high, so in 200x200
+	// it's 184 pixels across, and the origin is at 8, 146
+	const size = 200
+	for _, c := range []struct {
+		closed bool
+		want   int16
+	}{
+		{true, 600},
+		{false, 100},
+	} {
+		f := testFractal(t, base)
+		f.Settings.ClosedCurve = c.closed
+		path := filepath.Join(t.TempDir(), "curve.png")
+		if err := f.ExportPNG(path, 1, size, size, 1, 0, 0); err != nil {
+			t.Fatalf("export: %s", err)
+		}
+		img := readPNGFile(t, path)
+		got := color.NRGBAModel.Convert(img.At(8, 146)).(color.NRGBA)
+		if want := toNRGBA(f.colorTab[c.want]); got != want {
+			t.Errorf("closed %t: origin is %v, want color %d, %v", c.closed, got, c.want, want)
+		}
+	}
+}
+
+// partialPixels counts the pixels of img which are neither black nor at
+// full brightness, which is to say, antialiased edge pixels.
+func partialPixels(img *image.NRGBA) int {
+	n := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		bright := img.Pix[i]
+		if g := img.Pix[i+1]; g > bright {
+			bright = g
+		}
+		if b := img.Pix[i+2]; b > bright {
+			bright = b
+		}
+		if bright != 0 && bright != 255 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRenderToImageSSAA(t *testing.T) {
+	// depth 1 of the tent base is two diagonal lines
+	f := testFractal(t, tentBase())
+	plain, err := f.RenderToImage(1, 64, 64, 1, 0)
+	if err != nil {
+		t.Fatalf("rendering without supersampling: %v", err)
+	}
+	smooth, err := f.RenderToImage(1, 64, 64, 4, 0)
+	if err != nil {
+		t.Fatalf("rendering with supersampling: %v", err)
+	}
+	if n := partialPixels(plain); n != 0 {
+		t.Errorf("without supersampling, %d pixels are partly lit, want none", n)
+	}
+	if n := partialPixels(smooth); n == 0 {
+		t.Errorf("with 4x supersampling, no pixels are partly lit, so the edges are jagged")
+	}
+	if _, err := f.RenderToImage(1, 64, 64, maxSSAA+1, 0); err == nil {
+		t.Errorf("supersampling past %d should fail", maxSSAA)
+	}
+}
+
+func TestColor2Endpoints(t *testing.T) {
+	// a gradient runs from Color to Color2 whatever the previous point's
+	// color is
+	points := []Point{
+		{Vec: pixel.Vec{X: 9}, Color: 500},
+		{Vec: pixel.Vec{X: 19}, Color: 100, Color2: 300, Flags: HasColor2},
+	}
+	img := newIndexImage(20, 1)
+	img.drawPoints(points, func(v pixel.Vec) pixel.Vec { return v }, 1, true, false)
+	for x, want := range map[int]int16{10: 120, 14: 200, 19: 300} {
+		if got := img.at(x, 0); got != want {
+			t.Errorf("pixel %d is color %d, want %d", x, got, want)
+		}
+	}
+	// deeper copies of the gradient keep its shape
+	f := testFractal(t, []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}, Color: 100, Color2: 300, Flags: HasColor2},
+		{Vec: pixel.Vec{X: 1}, Color: 50},
+	})
+	f.Render(1)
+	f.Render(2)
+	for i, p := range f.Points(2) {
+		if p.Flags&HasColor2 != 0 && modPlus(p.Color2-p.Color, 1024) != 200 {
+			t.Errorf("depth 2 point %d: gradient %d to %d, want a span of 200", i, p.Color, p.Color2)
+		}
+	}
+}
+
+func TestChaikin(t *testing.T) {
+	points := []Point{
+		{Vec: pixel.Vec{X: 0.5, Y: 0.5}},
+		{Vec: pixel.Vec{X: 1}},
+	}
+	for passes, want := range []int{2, 3, 5, 9} {
+		smooth := chaikin(points, passes)
+		if len(smooth) != want {
+			t.Errorf("%d passes: %d points, want %d", passes, len(smooth), want)
+		}
+		// the last point stays put, and the first is still on the
+		// segment from the origin
+		if smooth[len(smooth)-1] != points[1] {
+			t.Errorf("%d passes: ends at %v, want %v", passes, smooth[len(smooth)-1], points[1])
+		}
+		if first := smooth[0].Vec; first.X != first.Y || first.X <= 0 || first.X > 0.5 {
+			t.Errorf("%d passes: starts at %v, off the first segment", passes, first)
+		}
+	}
+	if got := chaikinPasses(10, maxSmooth); got != maxSmooth {
+		t.Errorf("10 points get %d passes, want all %d", got, maxSmooth)
+	}
+	// a million points can only double twice
+	if got := chaikinPasses(1<<20, maxSmooth); got != 2 {
+		t.Errorf("a million points get %d passes, want 2", got)
+	}
+	if got := chaikinPasses(maxSmoothPoints, maxSmooth); got != 0 {
+		t.Errorf("%d points get %d passes, want none", maxSmoothPoints, got)
+	}
+}
+
+// drawnExtent yields the size of the box around everything drawn in img.
+func drawnExtent(img *indexImage) (w, h int) {
+	minX, minY, maxX, maxY := img.w, img.h, -1, -1
+	for y := 0; y < img.h; y++ {
+		for x := 0; x < img.w; x++ {
+			if img.at(x, y) < 0 {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	return maxX - minX + 1, maxY - minY + 1
+}
+
+func TestPixelAspectExport(t *testing.T) {
+	// depth 1 of the tent is twice as wide as it is tall; stretching
+	// pixels by 2 makes that 4
+	for _, c := range []struct {
+		aspect, ratio float64
+	}{
+		{1, 2},
+		{2, 4},
+	} {
+		f := testFractal(t, tentBase())
+		f.Settings.PixelAspect = c.aspect
+		img, err := f.rasterize(1, 400, 400, 1, 0)
+		if err != nil {
+			t.Fatalf("rasterize: %s", err)
+		}
+		w, h := drawnExtent(img)
+		if ratio := float64(w) / float64(h); math.Abs(ratio-c.ratio) > 0.05*c.ratio {
+			t.Errorf("aspect %g: drawn %dx%d, ratio %.2f, want %g", c.aspect, w, h, ratio, c.ratio)
+		}
+		// the SVG export stretches its coordinates the same way
+		if got := f.svgX(1) / -f.svgY(1); got != c.aspect {
+			t.Errorf("aspect %g: SVG stretches by %g", c.aspect, got)
+		}
+	}
+}
+
+// TestRenderPixelArt checks that pixel art is rasterized at the size over
+// the pixel size, rounding up, and that every pixel of the output is the
+// low resolution pixel it's in.
+func TestRenderPixelArt(t *testing.T) {
+	f := testFractal(t, tentBase())
+	const w, h, size = 100, 70, 4
+	img, err := f.RenderPixelArt(3, w, h, size)
+	if err != nil {
+		t.Fatalf("pixel art: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, w, h) {
+		t.Fatalf("pixel art is %v, want %dx%d", got, w, h)
+	}
+	// 100x70 in 4 pixel pixels is 25x18, with the last row half cut off
+	small, err := f.rasterize(3, 25, 18, 1, 0)
+	if err != nil {
+		t.Fatalf("rasterize: %v", err)
+	}
+	low := f.colorize(small, 25, 18, 1, 0, true)
+	drawn := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			want := low.NRGBAAt(x/size, y/size)
+			if got := img.NRGBAAt(x, y); got != want {
+				t.Fatalf("pixel %d, %d is %v, want %v", x, y, got, want)
+			}
+			if want.R|want.G|want.B != 0 {
+				drawn++
+			}
+		}
+	}
+	if drawn == 0 {
+		t.Errorf("nothing drawn")
+	}
+	if _, err := f.RenderPixelArt(3, w, h, 8); err == nil {
+		t.Errorf("13x9 pixels, too small for the margins, didn't fail")
+	}
+}
+
+// TestGamma renders the tent in mid-gray at several gammas, and checks
+// that the gray moves to 0.5 to the power 1/gamma, in exports and, to
+// within a step of rounding, on the display.
+func TestGamma(t *testing.T) {
+	f := testFractal(t, tentBase())
+	f.Settings.Vignette = 0
+	f.colorTab = make([]pixel.RGBA, 1024)
+	for i := range f.colorTab {
+		f.colorTab[i] = pixel.RGBA{R: 0.5, G: 0.5, B: 0.5, A: 1}
+	}
+	for _, c := range []struct {
+		gamma float64
+		want  uint8
+	}{{1, 128}, {2, 180}, {0.5, 64}} {
+		f.Settings.Gamma = c.gamma
+		img, err := f.RenderToImage(1, 64, 64, 1, 0)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		var gray uint8
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i] > gray {
+				gray = img.Pix[i]
+			}
+		}
+		if gray != c.want {
+			t.Errorf("gamma %g: mid-gray rendered as %d, want %d", c.gamma, gray, c.want)
+		}
+		pix := []uint8{128, 128, 128, 255}
+		gammaPixels(pix, c.gamma)
+		if d := int(pix[0]) - int(c.want); d < -1 || d > 1 || pix[3] != 255 {
+			t.Errorf("gamma %g: mid-gray displayed as %v, want %d", c.gamma, pix, c.want)
+		}
+	}
+}
+
+// TestOriginSegmentExport exports depth 1 of the tent with and without
+// DrawOriginSegment, and checks that the first segment, which starts at the
+// origin, is only drawn when it's set, as on the screen.
+func TestOriginSegmentExport(t *testing.T) {
+	// as in TestClosedCurveExport, the origin is at 8, 146; a little way
+	// along the first segment is 20, 134
+	const size = 200
+	for _, origin := range []bool{true, false} {
+		f := testFractal(t, tentBase())
+		f.Settings.DrawOriginSegment = origin
+		img, err := f.RenderToImage(1, size, size, 1, 0)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		c := img.NRGBAAt(20, 134)
+		if drawn := c.R|c.G|c.B != 0; drawn != origin {
+			t.Errorf("origin segment %t: first segment drawn %t", origin, drawn)
+		}
+		if c := img.NRGBAAt(size-20, 134); c.R|c.G|c.B == 0 {
+			t.Errorf("origin segment %t: second segment not drawn", origin)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// The edit operations an EditEvent can record.
+const (
+	opToggle    = "toggle"    // Amount is the flag
+	opColor     = "color"     // Amount is added to Color
+	opColor2    = "color2"    // Amount is added to Color2
+	opSetColor  = "setcolor"  // Amount is the new Color
+	opX         = "x"         // Amount is added to X
+	opY         = "y"         // Amount is added to Y
+	opAdd       = "add"       // Amount is how far along the segment
+	opSubdivide = "subdivide" // every segment
+	opDel       = "del"
+	opClone     = "clone"
+	opMerge     = "merge"
+	opMirror    = "mirror"
+	opRoot      = "root" // Root is the new root
+	opSet       = "set"  // Base is the whole new base
+	opUndo      = "undo"
+)
+
+// EditEvent is one edit to a fractal's base, as recorded by a sessionLog,
+// with enough information to do it again. Points is the selection it
+// applied to. Edits which don't reduce to a simple operation, such as
+// dragging a point or loading a file, are recorded as the base they left.
+type EditEvent struct {
+	At     time.Duration `json:"at"` // since the recording started
+	Op     string        `json:"op"`
+	Points []int         `json:"points,omitempty"`
+	Amount float64       `json:"amount,omitempty"`
+	Root   *Point        `json:"root,omitempty"`
+	Base   []Point       `json:"base,omitempty"`
+}
+
+// sessionLog records edits to a file, one JSON EditEvent per line, for
+// -record. Each event is written as it happens, so a crash doesn't lose
+// the edits leading up to it. A nil *sessionLog records nothing.
+type sessionLog struct {
+	file    *os.File
+	enc     *json.Encoder
+	started time.Time
+}
+
+// openSession creates the named file to record a session to.
+func openSession(path string) (*sessionLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("file create: %s", err)
+	}
+	return &sessionLog{file: file, enc: json.NewEncoder(file), started: time.Now()}, nil
+}
+
+// Record writes an event, stamping it with the time since recording
+// started.
+func (s *sessionLog) Record(ev EditEvent) {
+	if s == nil {
+		return
+	}
+	ev.At = time.Since(s.started)
+	if err := s.enc.Encode(ev); err != nil {
+		fmt.Printf("record: %s\n", err)
+	}
+}
+
+// Close closes the file.
+func (s *sessionLog) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// record records an edit to the session, if there is one.
+func (f *Fractal) record(ev EditEvent) {
+	f.session.Record(ev)
+}
+
+// recordBase records the current base, for edits which aren't a simple
+// operation.
+func (f *Fractal) recordBase() {
+	if f.session == nil {
+		return
+	}
+	base := make([]Point, len(f.Base))
+	copy(base, f.Base)
+	f.record(EditEvent{Op: opSet, Base: base})
+}
+
+// ReadSession reads the events recorded by -record from the named file.
+func ReadSession(path string) ([]EditEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []EditEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, batchMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		var ev EditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return events, fmt.Errorf("line %d: %s", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// Replay applies recorded edits to the fractal, in order, selecting the
+// points each applied to first. The edits go through the usual methods, so
+// they can be undone, and recorded again. It stops at the first event it
+// doesn't understand.
+func (f *Fractal) Replay(events []EditEvent) error {
+	for i, ev := range events {
+		f.SelectPoints(ev.Points)
+		switch ev.Op {
+		case opToggle:
+			f.Toggle(int(ev.Amount))
+		case opColor:
+			f.ColorChange(int(ev.Amount))
+		case opColor2:
+			f.Color2Change(int(ev.Amount))
+		case opSetColor:
+			f.SetColorAbsolute(int16(ev.Amount))
+		case opX:
+			f.XChange(ev.Amount)
+		case opY:
+			f.YChange(ev.Amount)
+		case opAdd:
+			f.AddPointAt(ev.Amount)
+		case opSubdivide:
+			f.SubdivideAll()
+		case opDel:
+			f.DelPoint()
+		case opClone:
+			f.ClonePoint()
+		case opMerge:
+			f.MergePoint()
+		case opMirror:
+			f.MirrorChange()
+		case opRoot:
+			if ev.Root == nil {
+				return fmt.Errorf("replay: event %d: root with no root", i+1)
+			}
+			// as RootChange does, so an undo after it undoes it
+			f.pushUndo()
+			f.Root = *ev.Root
+			f.record(ev)
+			f.Changed()
+		case opSet:
+			f.pushUndo()
+			f.setBase(append([]Point(nil), ev.Base...))
+			f.recordBase()
+			f.Alloc()
+		case opUndo:
+			f.Undo()
+		default:
+			return fmt.Errorf("replay: event %d: unknown op %q", i+1, ev.Op)
+		}
+	}
+	return nil
+}
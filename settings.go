@@ -0,0 +1,395 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/faiface/pixel"
+)
+
+// Settings are the display settings which aren't part of the fractal's
+// geometry, but are needed to reproduce how it looked. They're saved along
+// with the fractal. Files saved before settings existed get the defaults,
+// and so do any settings a file doesn't mention.
+type Settings struct {
+	// Scale is the zoom level, in steps of 5%, though it needn't be a
+	// whole number of steps.
+	Scale float64 `json:"scale"`
+	// Pan moves the view away from the middle of the fractal, in fractal
+	// units.
+	Pan pixel.Vec `json:"pan"`
+	// DepthCap limits the depths drawn (0 for no limit), and
+	// OnlyDeepest draws just the deepest one shown.
+	DepthCap    int  `json:"depthCap"`
+	OnlyDeepest bool `json:"onlyDeepest"`
+	// In manual depth mode, new depths are only rendered on request.
+	ManualDepth bool `json:"manualDepth"`
+	// Palette rotation is display-only, and measured in color table
+	// entries; speed is per second.
+	AutoRotatePalette bool    `json:"autoRotatePalette"`
+	PaletteSpeed      float64 `json:"paletteSpeed"`
+	PaletteOffset     float64 `json:"paletteOffset"`
+	// LogDepthColor maps depths onto the palette logarithmically, rather
+	// than linearly, in ColorByDepth mode.
+	LogDepthColor bool `json:"logDepthColor"`
+	// LineWidth is in canvas pixels.
+	LineWidth float64 `json:"lineWidth"`
+	// FocusDepth is the depth that per-depth tools, like vertex markers,
+	// look at.
+	FocusDepth int `json:"focusDepth"`
+	// ShowVertices marks the points of the focus depth.
+	ShowVertices bool `json:"showVertices"`
+	// ShowArrows marks the direction of each segment of the focus depth.
+	ShowArrows bool `json:"showArrows"`
+	// ShowMinimap shows the whole fractal in a corner, with the part the
+	// view shows outlined, for when it's zoomed in.
+	ShowMinimap bool `json:"showMinimap"`
+	// ShowCentroid marks the centroid of the focus depth, and the center
+	// of its bounds, to show how balanced it is.
+	ShowCentroid bool `json:"showCentroid"`
+	// ShowHull outlines the convex hull of the focus depth.
+	ShowHull bool `json:"showHull"`
+	// HiddenDepths has a bit set for each depth not to draw, with depth 1
+	// being 1<<1. It only affects what's drawn, not what's rendered.
+	HiddenDepths uint64 `json:"hiddenDepths"`
+	// ShowGrowth lists how many points each depth has, and where the
+	// point budget runs out.
+	ShowGrowth bool `json:"showGrowth"`
+	// StreamDepth, if non-zero, draws just that depth, computing it on
+	// the fly rather than storing it, so it can be deeper than MaxDepth.
+	StreamDepth int `json:"streamDepth"`
+	// OnionSkin shows a faint ghost of the fractal as it was before the
+	// current drag started.
+	OnionSkin bool `json:"onionSkin"`
+	// DrawOriginSegment draws the segment from the origin to the first
+	// point of each depth.
+	DrawOriginSegment bool `json:"drawOriginSegment"`
+	// ClosedCurve colors the segment from the origin as though the curve
+	// wrapped around from its last point.
+	ClosedCurve bool `json:"closedCurve"`
+	// PrerenderDepth is how many depths are rendered immediately after a
+	// change; deeper ones are rendered a frame at a time.
+	PrerenderDepth int `json:"prerenderDepth"`
+	// Exposure scales the brightness of the lines, which matters because
+	// they're drawn additively, so dense areas tend to blow out to white.
+	Exposure float64 `json:"exposure"`
+	// Gamma brightens the midtones, past 1, or darkens them, below it,
+	// without changing black or full brightness; 1 leaves colors alone.
+	Gamma float64 `json:"gamma"`
+	// ExplodeMagnitude is how far the explode animation moves branches,
+	// at its furthest, compared to the size of the fractal.
+	ExplodeMagnitude float64 `json:"explodeMagnitude"`
+	// Vignette darkens the fractal towards the edges of the view, and of
+	// exported images; 0 is off, and 1 fades the corners to black.
+	Vignette float64 `json:"vignette"`
+	// ShowInverse overlays the fractal generated by the inverse base.
+	ShowInverse bool `json:"showInverse"`
+	// Dragged points snap to the ends of the unit segment, and to the
+	// other base points if SnapPoints is set, within SnapRadius canvas
+	// pixels.
+	SnapEndpoints bool    `json:"snapEndpoints"`
+	SnapPoints    bool    `json:"snapPoints"`
+	SnapRadius    float64 `json:"snapRadius"`
+	// ClampDrag keeps dragged points within DragBounds, in fractal
+	// units, so a fast drag can't fling one off to somewhere absurd. It's
+	// off unless asked for, so drags go wherever the mouse does.
+	ClampDrag  bool       `json:"clampDrag"`
+	DragBounds pixel.Rect `json:"dragBounds"`
+	// SinglePass draws every depth in one go, rather than compositing
+	// them one at a time. It's faster, but overlapping depths blend
+	// differently, so it's off by default.
+	SinglePass bool `json:"singlePass"`
+	// RetainGeometry keeps the lines built for drawing the fractal, and
+	// draws them again on later frames until something changes, rather
+	// than rebuilding them every frame. It's off by default, since keeping
+	// them costs as much memory again as the points.
+	RetainGeometry bool `json:"retainGeometry"`
+	// LogicalSize is the size, in pixels, of the canvas the fractal is
+	// composed on, which is then scaled to fit the window. Line widths
+	// and the like are in these pixels. It's only read when the window
+	// opens.
+	LogicalSize pixel.Vec `json:"logicalSize"`
+	// LinearColor blends the hues of the color table in linear light.
+	LinearColor bool `json:"linearColor"`
+	// The gallery shows GallerySize by GallerySize variations, with
+	// points moved by up to GalleryJitter.
+	GallerySize   int     `json:"gallerySize"`
+	GalleryJitter float64 `json:"galleryJitter"`
+	// ExportSSAA is the supersampling factor for exported images.
+	ExportSSAA int `json:"exportSSAA"`
+	// ExportSmooth is how many passes of Chaikin corner cutting exports
+	// get, to round off the corners; 0 leaves them sharp.
+	ExportSmooth int `json:"exportSmooth"`
+	// ColorFreezeDepth, if not -1, stops colors accumulating past that
+	// depth, so deeper points keep their ancestors' colors.
+	ColorFreezeDepth int `json:"colorFreezeDepth"`
+	// Posterize, if non-zero, shows only that many colors from the
+	// palette, for a flat poster look. It doesn't change the fractal.
+	Posterize int `json:"posterize"`
+	// FlatColor draws every line in white, ignoring the palette.
+	FlatColor bool `json:"flatColor"`
+	// Overlay composites each depth over the ones before, rather than
+	// adding them up, so overlapping lines don't glow.
+	Overlay bool `json:"overlay"`
+	// Background is the color behind the fractal.
+	Background pixel.RGBA `json:"background"`
+	// Wireframe is set while the wireframe view is on, and ArtView holds
+	// the settings it replaced, to put back when it's turned off.
+	Wireframe bool        `json:"wireframe"`
+	ArtView   *ViewPreset `json:"artView,omitempty"`
+	// FlipYOutput mirrors the view and exports top to bottom, for tools
+	// which expect Y to go down. Unlike the FlipY flag, it doesn't change
+	// the fractal, only how it's shown.
+	FlipYOutput bool `json:"flipYOutput"`
+	// PixelAspect stretches the view and exports horizontally, by that
+	// much compared to vertically, for displays and plotters whose pixels
+	// aren't square; 1 is no stretch. Like FlipYOutput, it's only how the
+	// fractal is shown.
+	PixelAspect float64 `json:"pixelAspect"`
+	// PixelSize, past 1, renders the view and exports at that many times
+	// less resolution, then scales them back up, for chunky pixel art.
+	PixelSize int `json:"pixelSize"`
+	// SelectionColor is what the selected point's segment is drawn in, so
+	// it stands out; a transparent one uses the point's own color.
+	// SelectionWidth is how wide it is, in canvas pixels.
+	SelectionColor pixel.RGBA `json:"selectionColor"`
+	SelectionWidth float64    `json:"selectionWidth"`
+	// CapPolicy is what happens to lines where hidden segments cut them
+	// off; see the Cap constants.
+	CapPolicy int `json:"capPolicy"`
+	// HighlightChanges flashes the segments of the focus depth which an
+	// edit moved by more than ChangeThreshold, a fraction of the size
+	// of the fractal, for ChangeTime seconds.
+	HighlightChanges bool    `json:"highlightChanges"`
+	ChangeThreshold  float64 `json:"changeThreshold"`
+	ChangeTime       float64 `json:"changeTime"`
+	// Bookmarks are views saved with ctrl and a digit, and recalled with
+	// the digit; nil ones haven't been set.
+	Bookmarks [9]*Bookmark `json:"bookmarks"`
+}
+
+// Bookmark is a saved view: the zoom, where it's panned to, and which
+// depths are shown.
+type Bookmark struct {
+	Scale    float64   `json:"scale"`
+	Pan      pixel.Vec `json:"pan"`
+	DepthCap int       `json:"depthCap"`
+}
+
+// towards yields the view t of the way from b to to, for t from 0 to 1.
+// Scale is in zoom steps, so moving it evenly zooms at a steady rate,
+// rather than rushing through the first half. The depths shown aren't
+// something to blend, so they're to's.
+func (b Bookmark) towards(to Bookmark, t float64) Bookmark {
+	return Bookmark{
+		Scale:    b.Scale + (to.Scale-b.Scale)*t,
+		Pan:      pixel.Lerp(b.Pan, to.Pan, t),
+		DepthCap: to.DepthCap,
+	}
+}
+
+// ViewPreset is a group of settings which a named view sets all at once.
+type ViewPreset struct {
+	LineWidth  float64    `json:"lineWidth"`
+	Exposure   float64    `json:"exposure"`
+	Vignette   float64    `json:"vignette"`
+	Posterize  int        `json:"posterize"`
+	FlatColor  bool       `json:"flatColor"`
+	Overlay    bool       `json:"overlay"`
+	Background pixel.RGBA `json:"background"`
+}
+
+// wireframeView is for looking at the geometry rather than the art: thin
+// flat lines on a plain background, with no glow.
+var wireframeView = ViewPreset{
+	LineWidth:  2,
+	Exposure:   1,
+	FlatColor:  true,
+	Overlay:    true,
+	Background: pixel.RGBA{R: .1, G: .1, B: .12, A: 1},
+}
+
+// viewPreset yields the current values of the settings a view sets.
+func (s *Settings) viewPreset() ViewPreset {
+	return ViewPreset{
+		LineWidth:  s.LineWidth,
+		Exposure:   s.Exposure,
+		Vignette:   s.Vignette,
+		Posterize:  s.Posterize,
+		FlatColor:  s.FlatColor,
+		Overlay:    s.Overlay,
+		Background: s.Background,
+	}
+}
+
+// useViewPreset sets the settings a view sets.
+func (s *Settings) useViewPreset(v ViewPreset) {
+	s.LineWidth = v.LineWidth
+	s.Exposure = v.Exposure
+	s.Vignette = v.Vignette
+	s.Posterize = v.Posterize
+	s.FlatColor = v.FlatColor
+	s.Overlay = v.Overlay
+	s.Background = v.Background
+}
+
+// WireframeChange switches between the wireframe view and whatever the
+// settings were before it was turned on.
+func (s *Settings) WireframeChange() {
+	if s.Wireframe {
+		if s.ArtView != nil {
+			s.useViewPreset(*s.ArtView)
+		}
+		s.Wireframe, s.ArtView = false, nil
+		return
+	}
+	art := s.viewPreset()
+	s.useViewPreset(wireframeView)
+	s.Wireframe, s.ArtView = true, &art
+}
+
+// The range of PixelAspect, which is generous; past it, the fractal would
+// be a line.
+const (
+	minPixelAspect = 0.1
+	maxPixelAspect = 10
+)
+
+// aspectScale yields how much to scale X and Y by for PixelAspect. The
+// smaller one is scaled down, rather than the larger up, so that the
+// stretched fractal still fits where it did.
+func (s *Settings) aspectScale() pixel.Vec {
+	if s.PixelAspect >= 1 {
+		return pixel.Vec{X: 1, Y: 1 / s.PixelAspect}
+	}
+	return pixel.Vec{X: s.PixelAspect, Y: 1}
+}
+
+// DepthHiddenChange hides the given depth if it's shown, and shows it if
+// it's hidden.
+func (s *Settings) DepthHiddenChange(depth int) {
+	if depth >= 0 && depth < 64 {
+		s.HiddenDepths ^= 1 << uint(depth)
+	}
+}
+
+// hiddenDepthList lists the hidden depths, such as "1,2,5".
+func (s *Settings) hiddenDepthList() string {
+	var depths []string
+	for d := 0; d < 64; d++ {
+		if s.HiddenDepths&(1<<uint(d)) != 0 {
+			depths = append(depths, strconv.Itoa(d))
+		}
+	}
+	return strings.Join(depths, ",")
+}
+
+// DefaultSettings yields the settings used when nothing else has been
+// specified.
+func DefaultSettings() Settings {
+	return Settings{
+		PaletteSpeed:      64,
+		LineWidth:         2,
+		FocusDepth:        1,
+		OnionSkin:         true,
+		DrawOriginSegment: true,
+		ClosedCurve:       true,
+		PrerenderDepth:    5,
+		Exposure:          1,
+		Gamma:             1,
+		ExplodeMagnitude:  0.15,
+		SnapEndpoints:     true,
+		SnapRadius:        10,
+		DragBounds:        pixel.R(-2, -2.5, 3, 2.5),
+		LogicalSize:       pixel.Vec{X: 2000, Y: 1600},
+		GallerySize:       3,
+		GalleryJitter:     0.05,
+		ExportSSAA:        2,
+		ColorFreezeDepth:  -1,
+		Background:        pixel.RGBA{A: 1},
+		ChangeThreshold:   0.001,
+		ChangeTime:        1,
+		PixelAspect:       1,
+		PixelSize:         1,
+		SelectionColor:    pixel.RGBA{R: 1, G: 1, B: 1, A: 1},
+		SelectionWidth:    6,
+	}
+}
+
+// Validate fixes up settings which can't be used as-is, such as might come
+// from a hand-edited file.
+func (s *Settings) Validate() {
+	def := DefaultSettings()
+	if s.DepthCap < 0 {
+		s.DepthCap = def.DepthCap
+	}
+	if !(s.LineWidth > 0) {
+		s.LineWidth = def.LineWidth
+	}
+	if s.StreamDepth < 0 {
+		s.StreamDepth = def.StreamDepth
+	}
+	if s.ColorFreezeDepth < -1 {
+		s.ColorFreezeDepth = def.ColorFreezeDepth
+	}
+	if !(s.ChangeThreshold >= 0) {
+		s.ChangeThreshold = def.ChangeThreshold
+	}
+	if !(s.ChangeTime >= 0) {
+		s.ChangeTime = def.ChangeTime
+	}
+	if s.Posterize < 0 || s.Posterize > maxPosterize {
+		s.Posterize = def.Posterize
+	}
+	if s.ExportSSAA < 1 || s.ExportSSAA > maxSSAA {
+		s.ExportSSAA = def.ExportSSAA
+	}
+	if s.CapPolicy < 0 || s.CapPolicy >= capPolicies {
+		s.CapPolicy = def.CapPolicy
+	}
+	if !(s.SelectionWidth > 0) {
+		s.SelectionWidth = def.SelectionWidth
+	}
+	if !(s.PixelAspect >= minPixelAspect && s.PixelAspect <= maxPixelAspect) {
+		s.PixelAspect = def.PixelAspect
+	}
+	if s.PixelSize < 1 || s.PixelSize > maxPixelSize {
+		s.PixelSize = def.PixelSize
+	}
+	if s.ExportSmooth < 0 || s.ExportSmooth > maxSmooth {
+		s.ExportSmooth = def.ExportSmooth
+	}
+	if s.GallerySize < 1 {
+		s.GallerySize = def.GallerySize
+	}
+	if !(s.GalleryJitter >= 0) {
+		s.GalleryJitter = def.GalleryJitter
+	}
+	if !(s.LogicalSize.X >= 1 && s.LogicalSize.Y >= 1) {
+		s.LogicalSize = def.LogicalSize
+	}
+	if !(s.DragBounds.W() > 0 && s.DragBounds.H() > 0) {
+		s.DragBounds = def.DragBounds
+	}
+	if !(s.SnapRadius > 0) {
+		s.SnapRadius = def.SnapRadius
+	}
+	if !(s.Vignette >= 0 && s.Vignette <= 1) {
+		s.Vignette = def.Vignette
+	}
+	if !(s.Exposure > 0) {
+		s.Exposure = def.Exposure
+	}
+	if !(s.ExplodeMagnitude >= 0 && s.ExplodeMagnitude <= maxExplode) {
+		s.ExplodeMagnitude = def.ExplodeMagnitude
+	}
+	if !(s.Gamma >= minGamma && s.Gamma <= maxGamma) {
+		s.Gamma = def.Gamma
+	}
+	if s.PrerenderDepth < 0 {
+		s.PrerenderDepth = def.PrerenderDepth
+	}
+	if s.FocusDepth < 1 {
+		s.FocusDepth = def.FocusDepth
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// maxSmooth is the most Chaikin passes exports allow; each one roughly
+// doubles the number of points. Deep depths already have a lot of points,
+// so there are only as many passes as keep them within maxSmoothPoints.
+const (
+	maxSmooth       = 6
+	maxSmoothPoints = 1 << 22
+)
+
+// chaikinPasses yields how many of the given passes of chaikin n points can
+// have without ending up with more than maxSmoothPoints.
+func chaikinPasses(n, passes int) int {
+	for done := 0; done < passes; done++ {
+		n = 2*n - 1
+		if n > maxSmoothPoints {
+			return done
+		}
+	}
+	return passes
+}
+
+// chaikin rounds off the corners of the curve through points, which starts
+// at the origin like every depth, with passes of Chaikin's corner cutting:
+// each segment is replaced by the middle half of it, and the ends of those
+// are joined up. The origin and the last point stay where they are, so n
+// points become 2n-1 each pass. The new points get the color and flags of
+// the point ending the segment they came from, with gradients split along
+// it. It stops early rather than go past maxSmoothPoints.
+func chaikin(points []Point, passes int) []Point {
+	for passes = chaikinPasses(len(points), passes); passes > 0 && len(points) > 1; passes-- {
+		out := make([]Point, 0, 2*len(points)-1)
+		prev := pixel.Vec{}
+		for k, p := range points {
+			at := func(t float64) Point {
+				q := p
+				q.Vec = pixel.Lerp(prev, p.Vec, t)
+				return q
+			}
+			gradient := p.Flags&HasColor2 != 0
+			// the segment ending at the first point of a cut goes round
+			// the corner, so a gradient gets just its first quarter
+			if k > 0 {
+				q := at(0.25)
+				if gradient {
+					q.Color2 = lerpColor(p.Color, p.Color2, 0.25)
+				}
+				out = append(out, q)
+			}
+			from, to := 0.25, 0.75
+			if k == 0 {
+				from = 0
+			}
+			if k == len(points)-1 {
+				to = 1
+			}
+			last := at(to)
+			if gradient {
+				last.Color = lerpColor(p.Color, p.Color2, from)
+				last.Color2 = lerpColor(p.Color, p.Color2, to)
+			}
+			out = append(out, last)
+			prev = p.Vec
+		}
+		points = out
+	}
+	return points
+}
+
+// lerpColor interpolates between two color indices, as Draw does along a
+// gradient.
+func lerpColor(c0, c1 int16, t float64) int16 {
+	return c0 + int16(math.Round(float64(c1-c0)*t))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// RenderStats are the numbers -stats serves, for watching the performance
+// of a long session from outside.
+type RenderStats struct {
+	Depth      int       `json:"depth"`
+	MaxDepth   int       `json:"maxDepth"`
+	Points     int       `json:"points"` // in the rendered depths
+	Budget     int       `json:"budget"` // points allocated for all depths
+	Frames     int       `json:"frames"`
+	LastFPS    int       `json:"lastFPS"`
+	AverageFPS float64   `json:"averageFPS"`
+	RenderMS   []float64 `json:"renderMS"` // most recent render of each depth
+}
+
+// stats is updated by the display loop and read by the HTTP server's
+// goroutines, so it's only touched with statsMu held.
+var (
+	statsMu sync.Mutex
+	stats   RenderStats
+)
+
+// updateStats records the fractal's current state and the frame counts.
+func updateStats(f *Fractal, frames, lastFPS int, averageFPS float64) {
+	s := RenderStats{
+		Depth:      f.Depth,
+		MaxDepth:   f.MaxDepth,
+		Budget:     1 << f.MaxOOM,
+		Frames:     frames,
+		LastFPS:    lastFPS,
+		AverageFPS: averageFPS,
+		RenderMS:   make([]float64, f.Depth+1),
+	}
+	for i := 0; i <= f.Depth; i++ {
+		s.Points += len(f.lines[i])
+		s.RenderMS[i] = f.renderTimes[i].Seconds() * 1000
+	}
+	statsMu.Lock()
+	stats = s
+	statsMu.Unlock()
+}
+
+// serveStats publishes the stats with expvar, and serves them, along with
+// the rest of expvar's variables, on /debug/vars at addr.
+func serveStats(addr string) {
+	expvar.Publish("render", expvar.Func(func() interface{} {
+		statsMu.Lock()
+		defer statsMu.Unlock()
+		return stats
+	}))
+	go func() {
+		err := http.ListenAndServe(addr, nil)
+		if err != nil {
+			fmt.Printf("stats: %s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/sqweek/dialog"
+)
+
+// svgStrokes is how many line widths fit across the diagonal of an SVG
+// export; the lines are in fractal units, like everything else in it.
+const svgStrokes = 1500
+
+// ExportSVG writes the fractal to the named file as SVG, on black. It's
+// normally just the current depth. With layered, every rendered depth is
+// written as its own group, with an id like depth-3, for editing layer by
+// layer. The screen adds depths together, which SVG editors don't do, so
+// each layer gets an opacity of 1/sqrt(n) for n layers instead: a single
+// layer is still visible, and where they overlap, they build up. Hidden
+// segments are left out, as they are on screen. A non-zero widthMM gives
+// the image a physical size, for printing, and smoothPasses rounds off the
+// corners; see chaikin.
+func (f *Fractal) ExportSVG(path string, layered bool, widthMM float64, smoothPasses int) error {
+	if f.Depth < 1 {
+		return errors.New("export svg: nothing rendered yet")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	b := f.Bounds
+	width := b.Size().Len() / svgStrokes
+	b.Min, b.Max = b.Min.Sub(b.Size().Scaled(0.05)), b.Max.Add(b.Size().Scaled(0.05))
+	top := f.svgY(b.Max.Y)
+	if f.Settings.FlipYOutput {
+		top = f.svgY(b.Min.Y)
+	}
+	stretch := f.Settings.aspectScale()
+	left, bw, bh := f.svgX(b.Min.X), b.W()*stretch.X, b.H()*stretch.Y
+	size := ""
+	if widthMM != 0 {
+		size = fmt.Sprintf(" width=\"%gmm\" height=\"%gmm\"", widthMM, widthMM*bh/bw)
+	}
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\"%s viewBox=\"%g %g %g %g\">\n", size, left, top, bw, bh)
+	fmt.Fprintf(w, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" fill=\"black\"/>\n", left, top, bw, bh)
+	fmt.Fprintf(w, "<g fill=\"none\" stroke-width=\"%g\" stroke-linejoin=\"round\" stroke-linecap=\"round\">\n", width)
+	if layered {
+		opacity := 1 / math.Sqrt(float64(f.Depth))
+		for depth := 1; depth <= f.Depth; depth++ {
+			fmt.Fprintf(w, "<g id=\"depth-%d\" opacity=\"%.3f\">\n", depth, opacity)
+			f.writeSVGDepth(w, depth, smoothPasses)
+			fmt.Fprintf(w, "</g>\n")
+		}
+	} else {
+		f.writeSVGDepth(w, f.Depth, smoothPasses)
+	}
+	fmt.Fprintf(w, "</g>\n</svg>\n")
+	err = w.Flush()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// svgY converts a Y coordinate for SVG, where Y goes down, by negating it,
+// unless the output is flipped. Both it and svgX apply PixelAspect.
+func (f *Fractal) svgY(y float64) float64 {
+	y *= f.Settings.aspectScale().Y
+	if f.Settings.FlipYOutput {
+		return y
+	}
+	return -y
+}
+
+// svgX converts an X coordinate for SVG.
+func (f *Fractal) svgX(x float64) float64 {
+	return x * f.Settings.aspectScale().X
+}
+
+// writeSVGDepth writes the lines of one depth as polylines. An SVG line
+// has only one color, so each segment is drawn in the color of the point
+// it ends at, and runs of segments with the same color and style share a
+// polyline.
+func (f *Fractal) writeSVGDepth(w io.Writer, depth, smoothPasses int) {
+	points := chaikin(f.Points(depth), smoothPasses)
+	byDepth := f.ColorMode == ColorByDepth
+	depthColor := f.DepthColor(depth, f.Settings.LogDepthColor)
+	// dashes are a few times the stroke width
+	dash := f.Bounds.Size().Len() / svgStrokes * 4
+	open := false
+	var color int16
+	var dashed bool
+	var prev *Point
+	if f.Settings.DrawOriginSegment {
+		prev = &Point{}
+	}
+	for i := range points {
+		p := &points[i]
+		if p.Flags&Hide != 0 {
+			if open {
+				fmt.Fprintf(w, "\"/>\n")
+				open = false
+			}
+			prev = p
+			continue
+		}
+		c := p.Color
+		if byDepth {
+			c = depthColor
+		}
+		d := p.Flags&Dashed != 0
+		if open && (c != color || d != dashed) {
+			fmt.Fprintf(w, "\"/>\n")
+			open = false
+		}
+		if !open && prev != nil {
+			nc := toNRGBA(gammaCorrect(f.colorTab[modPlus(c, 1024)], f.Settings.Gamma))
+			style := ""
+			if d {
+				style = fmt.Sprintf(" stroke-dasharray=\"%g\"", dash)
+			}
+			fmt.Fprintf(w, "<polyline stroke=\"#%02x%02x%02x\"%s points=\"%g,%g", nc.R, nc.G, nc.B, style, f.svgX(prev.X), f.svgY(prev.Y))
+			open, color, dashed = true, c, d
+		}
+		if open {
+			fmt.Fprintf(w, " %g,%g", f.svgX(p.X), f.svgY(p.Y))
+		}
+		prev = p
+	}
+	if open {
+		fmt.Fprintf(w, "\"/>\n")
+	}
+}
+
+// ExportSVGDialog asks where to export the fractal as SVG, then does it,
+// at the print size if -width is set.
+func (f *Fractal) ExportSVGDialog(layered bool) {
+	filename, err := dialog.File().Filter("SVG images", "svg").Title("Export SVG").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	ps, err := printSize()
+	if err == nil {
+		err = f.ExportSVG(filename, layered, ps.WidthMM, f.Settings.ExportSmooth)
+	}
+	if err != nil {
+		fmt.Printf("export svg: %s\n", err)
+	}
+}
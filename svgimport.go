@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/faiface/pixel"
+	"github.com/sqweek/dialog"
+)
+
+// svgToken matches the commands and numbers of SVG path data and point
+// lists. Numbers can run together, as in "1.5.5" or "3-4", so they're
+// matched rather than split on separators.
+var svgToken = regexp.MustCompile(`[A-Za-z]|[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// svgVertex is a vertex of an imported path; jump means the line to it
+// isn't drawn, because a new subpath starts there.
+type svgVertex struct {
+	pixel.Vec
+	jump bool
+}
+
+// parseSVGPoints parses the points attribute of a polyline.
+func parseSVGPoints(s string) ([]svgVertex, error) {
+	tokens := svgToken.FindAllString(s, -1)
+	if len(tokens)%2 != 0 {
+		return nil, errors.New("polyline: odd number of coordinates")
+	}
+	var verts []svgVertex
+	for i := 0; i < len(tokens); i += 2 {
+		x, err := strconv.ParseFloat(tokens[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("polyline: %s", err)
+		}
+		y, err := strconv.ParseFloat(tokens[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("polyline: %s", err)
+		}
+		verts = append(verts, svgVertex{Vec: pixel.Vec{X: x, Y: y}})
+	}
+	return verts, nil
+}
+
+// parseSVGPath parses the d attribute of a path, which has to be made of
+// straight lines: M, L, H, V, and Z, or their relative forms. A second M
+// starts a new subpath, which becomes a jump.
+func parseSVGPath(d string) ([]svgVertex, error) {
+	tokens := svgToken.FindAllString(d, -1)
+	var verts []svgVertex
+	var at, start pixel.Vec
+	cmd := byte(0)
+	next := func() (float64, error) {
+		if len(tokens) == 0 {
+			return 0, fmt.Errorf("path: %c: missing coordinate", cmd)
+		}
+		v, err := strconv.ParseFloat(tokens[0], 64)
+		tokens = tokens[1:]
+		if err != nil {
+			return 0, fmt.Errorf("path: %c: %s", cmd, err)
+		}
+		return v, nil
+	}
+	for len(tokens) > 0 {
+		if c := tokens[0][0]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			cmd = c
+			tokens = tokens[1:]
+		} else if cmd == 0 {
+			return nil, fmt.Errorf("path: coordinate %s with no command", tokens[0])
+		}
+		relative := cmd >= 'a'
+		to := at
+		switch cmd {
+		case 'M', 'm', 'L', 'l':
+			x, err := next()
+			if err != nil {
+				return nil, err
+			}
+			y, err := next()
+			if err != nil {
+				return nil, err
+			}
+			to = pixel.Vec{X: x, Y: y}
+			if relative {
+				to = at.Add(to)
+			}
+		case 'H', 'h':
+			x, err := next()
+			if err != nil {
+				return nil, err
+			}
+			to.X = x
+			if relative {
+				to.X += at.X
+			}
+		case 'V', 'v':
+			y, err := next()
+			if err != nil {
+				return nil, err
+			}
+			to.Y = y
+			if relative {
+				to.Y += at.Y
+			}
+		case 'Z', 'z':
+			to = start
+		case 'C', 'c', 'S', 's', 'Q', 'q', 'T', 't', 'A', 'a':
+			return nil, fmt.Errorf("path: %c: curves aren't supported, only straight lines (M, L, H, V, Z)", cmd)
+		default:
+			return nil, fmt.Errorf("path: unknown command %c", cmd)
+		}
+		jump := cmd == 'M' || cmd == 'm'
+		if jump {
+			start = to
+			// more coordinates after a move are lines
+			if relative {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		}
+		if len(verts) == 0 && !jump {
+			return nil, errors.New("path: doesn't start with a move")
+		}
+		verts = append(verts, svgVertex{Vec: to, jump: jump && len(verts) > 0})
+		at = to
+		if cmd == 'Z' || cmd == 'z' {
+			// Z takes no coordinates, so a repeat needs a new command
+			cmd = 0
+		}
+	}
+	return verts, nil
+}
+
+// readSVGVertices finds the first path or polyline in an SVG file and
+// yields its vertices.
+func readSVGVertices(r io.Reader) ([]svgVertex, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, errors.New("no path or polyline found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range el.Attr {
+			switch {
+			case el.Name.Local == "path" && attr.Name.Local == "d":
+				return parseSVGPath(attr.Value)
+			case el.Name.Local == "polyline" && attr.Name.Local == "points":
+				return parseSVGPoints(attr.Value)
+			}
+		}
+	}
+}
+
+// ImportSVGPath reads the first path or polyline in the named SVG file,
+// and converts it to a base. SVG's Y goes down, so it's flipped to look
+// the same way up, then the path is moved, rotated, and scaled so that it
+// starts at [0,0] and ends at [1,0]. The first vertex becomes the implicit
+// origin, and each one after it a point; where the path moves without
+// drawing, the point is hidden. Colors go round the palette like the
+// presets' do. Paths with curves, with fewer than two vertices, which end
+// where they start, or with more than MaxBasePoints points, are rejected.
+func ImportSVGPath(path string) ([]Point, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	verts, err := readSVGVertices(file)
+	if err != nil {
+		return nil, fmt.Errorf("import svg: %s", err)
+	}
+	if len(verts) < 2 {
+		return nil, errors.New("import svg: the path needs at least two vertices")
+	}
+	if len(verts)-1 > MaxBasePoints {
+		return nil, fmt.Errorf("import svg: the path needs %d points, max is %d (see -maxbase)", len(verts)-1, MaxBasePoints)
+	}
+	for i := range verts {
+		verts[i].Y = -verts[i].Y
+		if !finite(verts[i].Vec) {
+			return nil, fmt.Errorf("import svg: vertex %d isn't finite", i+1)
+		}
+	}
+	first, last := verts[0].Vec, verts[len(verts)-1].Vec
+	if first == last {
+		return nil, errors.New("import svg: the path ends where it starts, so it can't be fitted to [0,0]-[1,0]")
+	}
+	fit := NewAffineBetween(Point{Vec: first}, Point{Vec: last})
+	base := make([]Point, len(verts)-1)
+	for i, v := range verts[1:] {
+		base[i].Vec = fit.Unproject(v.Vec)
+		if v.jump {
+			base[i].Flags = Hide
+		}
+		base[i].Color = int16(i * 128 % 1024)
+	}
+	// exactly, despite rounding
+	base[len(base)-1].Vec = pixel.Vec{X: 1}
+	return base, nil
+}
+
+// ImportSVGDialog asks for an SVG file, and replaces the base with the
+// path in it.
+func (f *Fractal) ImportSVGDialog() {
+	filename, err := dialog.File().Filter("SVG images", "svg").Title("Import SVG Path").Load()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	base, err := ImportSVGPath(filename)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	f.pushUndo()
+	f.setBase(base)
+	f.recordBase()
+	f.SelectPoint(-1)
+	f.Alloc()
+}
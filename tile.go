@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/faiface/pixel"
+	"github.com/sqweek/dialog"
+)
+
+// tileExportSize is the size, in pixels, of the square tiles
+// ExportTileDialog writes.
+const tileExportSize = 1024
+
+// ExportTile writes the given depth to the named file as a tileSize square
+// PNG which tiles seamlessly. The depth's bounds are fitted to the tile,
+// with no margin, and lines which go off one edge come back on the other,
+// which is the same as drawing the copies of the fractal in the tiles
+// around it and cropping to the middle one. It's supersampled and smoothed
+// like other exports, but not vignetted, which would show the seams.
+func (f *Fractal) ExportTile(path string, depth, tileSize int) error {
+	if depth < 1 {
+		return fmt.Errorf("export tile: depth %d too shallow", depth)
+	}
+	if tileSize < 1 || tileSize*tileSize > maxExportPixels {
+		return fmt.Errorf("export tile: can't make a %dx%d tile", tileSize, tileSize)
+	}
+	for f.Depth < depth {
+		if !f.Render(f.Depth + 1) {
+			return fmt.Errorf("export tile: can't render depth %d", f.Depth+1)
+		}
+	}
+	ssaa := f.Settings.ExportSSAA
+	size := tileSize * ssaa
+	bounds := f.BoundsAt(depth)
+	stretch := f.Settings.aspectScale()
+	scale := math.Min(float64(size)/math.Max(bounds.W()*stretch.X, 1e-9),
+		float64(size)/math.Max(bounds.H()*stretch.Y, 1e-9))
+	center := bounds.Center()
+	ySign := -1.0
+	if f.Settings.FlipYOutput {
+		ySign = 1
+	}
+	project := func(v pixel.Vec) pixel.Vec {
+		v = v.Sub(center).Scaled(scale)
+		return pixel.Vec{X: float64(size)/2 + v.X*stretch.X, Y: float64(size)/2 + ySign*v.Y*stretch.Y}
+	}
+	big := newIndexImage(size, size)
+	big.wrap = true
+	big.drawPoints(chaikin(f.Points(depth), f.Settings.ExportSmooth), project, ssaa, f.Settings.DrawOriginSegment, f.Settings.ClosedCurve)
+	return writePNG(path, f.colorize(big, tileSize, tileSize, ssaa, 0, false))
+}
+
+// ExportTileDialog asks where to export a tile of the current depth, then
+// does it.
+func (f *Fractal) ExportTileDialog() {
+	filename, err := dialog.File().Filter("PNG images", "png").Title("Export Tile").Save()
+	if err != nil {
+		fmt.Printf("file select: %s\n", err)
+		return
+	}
+	err = f.ExportTile(filename, f.Depth, tileExportSize)
+	if err != nil {
+		fmt.Printf("export tile: %s\n", err)
+	}
+}
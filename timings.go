@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// timingLog records how long each render takes, as CSV, for -timings.
+// A nil *timingLog records nothing.
+type timingLog struct {
+	file *os.File
+	w    *csv.Writer
+}
+
+// renderTimings is where Render records how long each depth of the
+// fractal being edited takes to render, if anywhere. Quiet fractals, such
+// as the onion skin or gallery thumbnails, aren't recorded.
+var renderTimings *timingLog
+
+// openTimings creates the named file and writes the CSV header to it.
+func openTimings(path string) (*timingLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("file create: %s", err)
+	}
+	t := &timingLog{file: file, w: csv.NewWriter(file)}
+	t.w.Write([]string{"depth", "points", "seconds"})
+	return t, nil
+}
+
+// Record adds a row for one render of a depth, and flushes it, so the rows
+// so far survive a crash.
+func (t *timingLog) Record(depth, points int, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.w.Write([]string{strconv.Itoa(depth), strconv.Itoa(points), strconv.FormatFloat(d.Seconds(), 'f', 6, 64)})
+	t.w.Flush()
+}
+
+// Close flushes anything not yet written, and closes the file.
+func (t *timingLog) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.w.Flush()
+	err := t.w.Error()
+	if cerr := t.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}